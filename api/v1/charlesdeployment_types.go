@@ -29,32 +29,312 @@ type CharlesDeploymentSpec struct {
 	// Important: Run "make" to regenerate code after modifying this file
 
 	// Foo is an example field of CharlesDeployment. Edit charlesdeployment_types.go to remove/update
+	// +listType=map
+	// +listMapKey=name
 	Components []Component `json:"components,omitempty"`
+	// SyncInterval is how often the component refs are resolved again to pick up
+	// new commits, periodic sync is disabled when empty
+	SyncInterval *metav1.Duration `json:"syncInterval,omitempty"`
+	// DryRun renders the components and reports what applying them would change in the
+	// ConfigMap named in status.dryRun, without changing the cluster
+	DryRun bool `json:"dryRun,omitempty"`
+	// Suspend stops the reconciliation, leaving the applied resources as they are
+	Suspend bool `json:"suspend,omitempty"`
 }
 
 // CharlesDeploymentStatus defines the observed state of CharlesDeployment
 type CharlesDeploymentStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// Components holds the last synced state of each component
+	Components []ComponentStatus `json:"components,omitempty"`
+	// DryRun summarizes the last dry run, its report being in the ConfigMap it names
+	DryRun *DryRunStatus `json:"dryRun,omitempty"`
+	// Conditions holds the Suspended condition
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// LastHandledSyncRequest is the last value of the sync-requested-at annotation acted upon
+	LastHandledSyncRequest string `json:"lastHandledSyncRequest,omitempty"`
+}
+
+type DryRunStatus struct {
+	ConfigMapName string `json:"configMapName"`
+	// Created, Changed and Pruned count the objects applying the components would create, change or leave behind
+	Created int32 `json:"created"`
+	Changed int32 `json:"changed"`
+	Pruned  int32 `json:"pruned"`
+	// Revisions are the commits each component was rendered from
+	Revisions map[string]string `json:"revisions,omitempty"`
+	// Time is when the report last changed
+	Time metav1.Time `json:"time,omitempty"`
 }
 
+// +kubebuilder:validation:XValidation:rule="!(has(self.jsonnet) && has(self.cue))",message="jsonnet and cue are mutually exclusive"
+// +kubebuilder:validation:XValidation:rule="self.namespace == oldSelf.namespace",message="namespace is immutable"
+// +kubebuilder:validation:XValidation:rule="self.provider == oldSelf.provider",message="provider is immutable"
 type Component struct {
-	Name           string  `json:"name"`
-	Image          string  `json:"image"`
-	Chart          string  `json:"chart"`
-	Provider       string  `json:"provider"`
-	Namespace      string  `json:"namespace"`
-	ChildResources []Child `json:"child_resources,omitempty"`
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+	// +kubebuilder:validation:Pattern=`^(?:(?:localhost|[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)+)(?::[0-9]+)?/|[a-zA-Z0-9-]+:[0-9]+/)?[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*(?::[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127})?(?:@sha256:[a-f0-9]{64})?$`
+	Image string `json:"image"`
+	// Chart is the repository url of the kustomization, such as
+	// https://github.com/org/repo//overlays/dev?ref=main
+	// +kubebuilder:validation:MinLength=1
+	Chart string `json:"chart"`
+	// +kubebuilder:validation:Enum=GITHUB
+	Provider string `json:"provider"`
+	// Namespace is where the namespaced objects the chart leaves without a namespace are applied,
+	// the defaulting webhook sets the CharlesDeployment namespace
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Namespace string `json:"namespace"`
+	// Ref is the branch, tag or commit SHA the chart is fetched from, the ref of the
+	// chart url is used when empty and the defaulting webhook sets main when it has none
+	Ref string `json:"ref,omitempty"`
+	// Strategy is how the new revisions of the ref are rolled out. Automatic applies them once resolved, Manual
+	// keeps the applied revision and reports the new one as pending until it is promoted. The defaulting
+	// webhook sets Automatic.
+	// +kubebuilder:validation:Enum=Automatic;Manual
+	Strategy string `json:"strategy,omitempty"`
+	// SecretRef names a Secret in the CharlesDeployment namespace holding the
+	// provider credentials, either a token or a GitHub App appID, installationID and privateKey
+	SecretRef string `json:"secretRef,omitempty"`
+	// CAConfigMapRef names a ConfigMap in the CharlesDeployment namespace whose
+	// ca.crt key holds the CA bundle trusted when reaching the provider
+	CAConfigMapRef string `json:"caConfigMapRef,omitempty"`
+	// Kustomize configures how the chart is built, the operator defaults apply when empty
+	Kustomize *KustomizeOptions `json:"kustomize,omitempty"`
+	// Directory selects the manifests loaded when the chart is a directory without kustomization
+	Directory *DirectoryOptions `json:"directory,omitempty"`
+	// Jsonnet renders the chart by evaluating a jsonnet entrypoint instead of building a kustomization
+	Jsonnet *JsonnetOptions `json:"jsonnet,omitempty"`
+	// Cue renders the chart by evaluating a CUE package instead of building a kustomization
+	Cue *CueOptions `json:"cue,omitempty"`
+	// Patches are strategic merge or JSON6902 patches applied on top of the chart
+	Patches           []Patch           `json:"patches,omitempty"`
+	CommonLabels      map[string]string `json:"commonLabels,omitempty"`
+	CommonAnnotations map[string]string `json:"commonAnnotations,omitempty"`
+	NamePrefix        string            `json:"namePrefix,omitempty"`
+	NameSuffix        string            `json:"nameSuffix,omitempty"`
+	// Replicas overrides the replica count of the named workloads
+	// +listType=map
+	// +listMapKey=name
+	Replicas []Replica `json:"replicas,omitempty"`
+	// Images override the name, tag or digest of the named container images
+	// +listType=map
+	// +listMapKey=name
+	Images []ImageOverride `json:"images,omitempty"`
+	// Substitute are the variables replacing ${NAME} placeholders in the string values of the rendered
+	// manifests, they take precedence over the SubstituteFrom ones. $${NAME} is kept as a literal ${NAME}
+	Substitute map[string]string `json:"substitute,omitempty"`
+	// SubstituteFrom lists the ConfigMaps and Secrets whose keys are substituted, later ones taking precedence
+	SubstituteFrom []SubstituteReference `json:"substituteFrom,omitempty"`
+	// SubstituteStrict fails the render when a placeholder has no variable nor default
+	SubstituteStrict bool `json:"substituteStrict,omitempty"`
+	// DependsOn lists the components that must be ready before this one is applied
+	//+listType=set
+	DependsOn      []string `json:"dependsOn,omitempty"`
+	ChildResources []Child  `json:"childResources,omitempty"`
+}
+
+// SubstituteReference names a ConfigMap or Secret in the CharlesDeployment namespace holding substitution variables
+type SubstituteReference struct {
+	// Kind is ConfigMap or Secret
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind string `json:"kind"`
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Optional ignores the reference when the object does not exist
+	Optional bool `json:"optional,omitempty"`
+}
+
+// DirectoryOptions select the manifests of a plain directory, the *.yaml, *.yml and *.json files of its top level by default
+type DirectoryOptions struct {
+	// Recursive also loads the manifests of the subdirectories
+	Recursive bool `json:"recursive,omitempty"`
+	// Include and Exclude are globs matched against the file name and its path relative to the directory
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// JsonnetOptions configure the evaluation of a jsonnet entrypoint, which must output a Kubernetes
+// object, a list of objects or an object whose fields are objects
+type JsonnetOptions struct {
+	// Entrypoint is the jsonnet file evaluated, relative to the chart path
+	// +kubebuilder:validation:MinLength=1
+	Entrypoint string `json:"entrypoint"`
+	// ExtVars are the external variables read with std.extVar
+	ExtVars map[string]string `json:"extVars,omitempty"`
+	// TLAs are the string top level arguments of the entrypoint function
+	TLAs map[string]string `json:"tlas,omitempty"`
+	// JPaths are library directories searched by imports, relative to the repository root
+	JPaths []string `json:"jpaths,omitempty"`
+}
+
+// CueOptions configure the evaluation of a CUE package
+type CueOptions struct {
+	// Package is the package evaluated relative to the chart path, the chart directory when empty
+	Package string `json:"package,omitempty"`
+	// Expression selects the value holding the objects, the whole package when empty
+	Expression string `json:"expression,omitempty"`
+	// Tags are injected into the @tag attributes of the package
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// Patch is an inline kustomize patch
+type Patch struct {
+	// Patch is the strategic merge patch or JSON6902 patch document
+	// +kubebuilder:validation:MinLength=1
+	Patch string `json:"patch"`
+	// Target selects the resources to patch, required by JSON6902 patches
+	Target *PatchTarget `json:"target,omitempty"`
+}
+
+// PatchTarget selects the resources a Patch applies to
+type PatchTarget struct {
+	Group              string `json:"group,omitempty"`
+	Version            string `json:"version,omitempty"`
+	Kind               string `json:"kind,omitempty"`
+	Name               string `json:"name,omitempty"`
+	Namespace          string `json:"namespace,omitempty"`
+	LabelSelector      string `json:"labelSelector,omitempty"`
+	AnnotationSelector string `json:"annotationSelector,omitempty"`
+}
+
+// ImageOverride replaces the container images called Name, like the images field of a kustomization
+type ImageOverride struct {
+	// +kubebuilder:validation:MinLength=1
+	Name    string `json:"name"`
+	NewName string `json:"newName,omitempty"`
+	NewTag  string `json:"newTag,omitempty"`
+	// +kubebuilder:validation:Pattern=`^sha256:[a-f0-9]{64}$`
+	Digest string `json:"digest,omitempty"`
+}
+
+// Replica sets the replica count of the workload called Name
+type Replica struct {
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10000
+	Count int64 `json:"count"`
+}
+
+// KustomizeOptions configure the kustomize build of a Component
+// +kubebuilder:validation:XValidation:rule="!has(self.enableExec) || !self.enableExec || (has(self.enableAlphaPlugins) && self.enableAlphaPlugins)",message="enableExec requires enableAlphaPlugins"
+type KustomizeOptions struct {
+	// EnableHelm inflates the helmCharts of the kustomization with the operator helm binary, when the
+	// operator allows it. The kustomization may then only load files under its root.
+	EnableHelm bool `json:"enableHelm,omitempty"`
+	// EnableAlphaPlugins enables KRM function plugins run as containers
+	EnableAlphaPlugins bool `json:"enableAlphaPlugins,omitempty"`
+	// EnableExec enables KRM function plugins run as executables, requires EnableAlphaPlugins
+	EnableExec bool `json:"enableExec,omitempty"`
+	// LoadRestrictor is LoadRestrictionsRootOnly or LoadRestrictionsNone, which is only accepted when the
+	// operator runs with it
+	// +kubebuilder:validation:Enum=LoadRestrictionsRootOnly;LoadRestrictionsNone
+	LoadRestrictor string `json:"loadRestrictor,omitempty"`
+	// Reorder is legacy to sort the resources by kind or none to keep the kustomization order
+	// +kubebuilder:validation:Enum=legacy;none
+	Reorder string `json:"reorder,omitempty"`
+}
+
+// ComponentStatus defines the observed state of a Component
+type ComponentStatus struct {
+	Name string `json:"name"`
+	// Revision is the commit SHA the component was last rendered from
+	Revision string `json:"revision,omitempty"`
+	// PendingRevision is the commit SHA the ref of a Manual component points to, held back until promoted
+	PendingRevision string `json:"pendingRevision,omitempty"`
+	// SpecHash is the hash of the component spec that was last applied
+	SpecHash     string      `json:"specHash,omitempty"`
+	LastSyncTime metav1.Time `json:"lastSyncTime,omitempty"`
+	// Ready tells whether the component was applied at the current spec and revision
+	Ready bool `json:"ready"`
+	// BlockedBy lists the dependencies keeping the component from being applied
+	BlockedBy []string `json:"blockedBy,omitempty"`
+	// Message explains why the component is not ready
+	Message string `json:"message,omitempty"`
+	// Hooks are the outcomes of the hooks run by the last sync of the component
+	Hooks []HookStatus `json:"hooks,omitempty"`
+	// Operation is the progress of the sync of the component while it waits for resources or hooks
+	Operation *OperationStatus `json:"operation,omitempty"`
+	// AppliedKinds are the kinds, and their namespaces, of the objects applied for the component,
+	// which are searched for objects no longer rendered
+	AppliedKinds []AppliedKind `json:"appliedKinds,omitempty"`
+}
+
+// OperationStatus is how far the sync of a component went, resumed at the next reconcile
+type OperationStatus struct {
+	// Revision and SpecHash are the commit and the component spec being synced
+	Revision string `json:"revision"`
+	SpecHash string `json:"specHash"`
+	// Stage is the index of the hook or resource wave being synced, among the SyncFail hooks once Failure is set
+	Stage int32 `json:"stage"`
+	// Applied tells whether the stage was applied, its health being checked
+	Applied bool `json:"applied,omitempty"`
+	// StartedAt is when the stage was applied
+	StartedAt metav1.Time `json:"startedAt,omitempty"`
+	// Failure is the error the sync failed with while the SyncFail hooks run
+	Failure string `json:"failure,omitempty"`
+}
+
+// AppliedKind is a kind applied in a namespace, Namespace being empty for cluster scoped kinds
+type AppliedKind struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+}
+
+// HookStatus is the outcome of a hook resource, annotated with charlescd.io/hook
+type HookStatus struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Hook is the phase the hook ran in
+	//+kubebuilder:validation:Enum=PreSync;PostSync;SyncFail
+	Hook string `json:"hook"`
+	// Result is Succeeded or Failed
+	//+kubebuilder:validation:Enum=Succeeded;Failed
+	Result     string      `json:"result"`
+	Message    string      `json:"message,omitempty"`
+	FinishedAt metav1.Time `json:"finishedAt,omitempty"`
 }
 
 type Child struct {
-	ApiVersion string
-	Name       string
-	Plural     string
+	ApiVersion    string `json:"apiVersion,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Plural        string `json:"plural,omitempty"`
+	ComponentName string `json:"componentName,omitempty"`
 }
 
+const (
+	// DeploymentLabel and ComponentLabel are set on the objects applied for a component
+	DeploymentLabel = "charlescd.io/deployment"
+	ComponentLabel  = "charlescd.io/component"
+	// ReconcileAnnotation set to ReconcileDisabled suspends the reconciliation like spec.suspend
+	ReconcileAnnotation = "charlescd.io/reconcile"
+	ReconcileDisabled   = "disabled"
+	// SyncRequestedAtAnnotation holds a timestamp, setting it to a new value applies every component
+	// again once, even when periodic sync is disabled
+	SyncRequestedAtAnnotation = "charlescd.io/sync-requested-at"
+	// SuspendedCondition is True while the reconciliation is suspended
+	SuspendedCondition = "Suspended"
+	// AutomaticStrategy and ManualStrategy are the strategies a Component rolls out new revisions with
+	AutomaticStrategy = "Automatic"
+	ManualStrategy    = "Manual"
+	// PromoteAnnotationPrefix and AbortAnnotationPrefix followed by a component name hold the pending
+	// revision of that Manual component to apply or to ignore
+	PromoteAnnotationPrefix = "promote.charlescd.io/"
+	AbortAnnotationPrefix   = "abort.charlescd.io/"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=cd
+//+kubebuilder:storageversion
 
 // CharlesDeployment is the Schema for the charlesdeployments API
 type CharlesDeployment struct {
@@ -65,6 +345,34 @@ type CharlesDeployment struct {
 	Status CharlesDeploymentStatus `json:"status,omitempty"`
 }
 
+// IsSuspended tells whether the reconciliation is suspended by spec.suspend or the reconcile annotation
+func (r *CharlesDeployment) IsSuspended() bool {
+	return r.Spec.Suspend || r.Annotations[ReconcileAnnotation] == ReconcileDisabled
+}
+
+// SyncRequest returns the sync-requested-at annotation when it was not acted upon yet
+func (r *CharlesDeployment) SyncRequest() (string, bool) {
+	requestedAt, ok := r.Annotations[SyncRequestedAtAnnotation]
+	if !ok || requestedAt == "" || requestedAt == r.Status.LastHandledSyncRequest {
+		return "", false
+	}
+	return requestedAt, true
+}
+
+// RolloutRevision returns the revision to apply for a component whose ref resolves to revision, and the
+// revision held back as pending. A Manual component keeps its applied revision until the new one is
+// promoted, a revision that was aborted being no longer reported as pending.
+func (r *CharlesDeployment) RolloutRevision(component Component, applied string, revision string) (string, string) {
+	if component.Strategy != ManualStrategy || applied == "" || applied == revision ||
+		r.Annotations[PromoteAnnotationPrefix+component.Name] == revision {
+		return revision, ""
+	}
+	if r.Annotations[AbortAnnotationPrefix+component.Name] == revision {
+		return applied, ""
+	}
+	return applied, revision
+}
+
 //+kubebuilder:object:root=true
 
 // CharlesDeploymentList contains a list of CharlesDeployment
@@ -0,0 +1,123 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestRolloutRevision(t *testing.T) {
+	tests := []struct {
+		name        string
+		strategy    string
+		annotations map[string]string
+		applied     string
+		revision    string
+		want        string
+		wantPending string
+	}{
+		{name: "automatic applies new revisions", strategy: AutomaticStrategy, applied: "a", revision: "b", want: "b"},
+		{name: "manual applies the first revision", strategy: ManualStrategy, revision: "a", want: "a"},
+		{name: "manual keeps the applied revision", strategy: ManualStrategy, applied: "a", revision: "a", want: "a"},
+		{name: "manual holds new revisions", strategy: ManualStrategy, applied: "a", revision: "b", want: "a", wantPending: "b"},
+		{
+			name:        "manual applies promoted revisions",
+			strategy:    ManualStrategy,
+			annotations: map[string]string{PromoteAnnotationPrefix + "backend": "b"},
+			applied:     "a",
+			revision:    "b",
+			want:        "b",
+		},
+		{
+			name:        "manual holds revisions newer than the promoted one",
+			strategy:    ManualStrategy,
+			annotations: map[string]string{PromoteAnnotationPrefix + "backend": "b"},
+			applied:     "b",
+			revision:    "c",
+			want:        "b",
+			wantPending: "c",
+		},
+		{
+			name:        "manual ignores aborted revisions",
+			strategy:    ManualStrategy,
+			annotations: map[string]string{AbortAnnotationPrefix + "backend": "b"},
+			applied:     "a",
+			revision:    "b",
+			want:        "a",
+		},
+		{
+			name:        "annotations of other components are ignored",
+			strategy:    ManualStrategy,
+			annotations: map[string]string{PromoteAnnotationPrefix + "frontend": "b"},
+			applied:     "a",
+			revision:    "b",
+			want:        "a",
+			wantPending: "b",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployment := CharlesDeployment{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+			component := Component{Name: "backend", Strategy: test.strategy}
+
+			revision, pending := deployment.RolloutRevision(component, test.applied, test.revision)
+
+			if revision != test.want || pending != test.wantPending {
+				t.Errorf("expected revision %q pending %q, got %q pending %q", test.want, test.wantPending, revision, pending)
+			}
+		})
+	}
+}
+
+func TestIsSuspended(t *testing.T) {
+	tests := []struct {
+		name        string
+		suspend     bool
+		annotations map[string]string
+		expected    bool
+	}{
+		{name: "reconciled", expected: false},
+		{name: "spec", suspend: true, expected: true},
+		{name: "annotation", annotations: map[string]string{ReconcileAnnotation: ReconcileDisabled}, expected: true},
+		{name: "other annotation value", annotations: map[string]string{ReconcileAnnotation: "enabled"}, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployment := CharlesDeployment{
+				ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations},
+				Spec:       CharlesDeploymentSpec{Suspend: test.suspend},
+			}
+
+			if deployment.IsSuspended() != test.expected {
+				t.Errorf("expected suspended %t", test.expected)
+			}
+		})
+	}
+}
+
+func TestSyncRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		lastHandled string
+		requested   bool
+	}{
+		{name: "no annotation"},
+		{name: "empty annotation", annotations: map[string]string{SyncRequestedAtAnnotation: ""}},
+		{name: "new request", annotations: map[string]string{SyncRequestedAtAnnotation: "2"}, lastHandled: "1", requested: true},
+		{name: "handled request", annotations: map[string]string{SyncRequestedAtAnnotation: "2"}, lastHandled: "2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployment := CharlesDeployment{
+				ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations},
+				Status:     CharlesDeploymentStatus{LastHandledSyncRequest: test.lastHandled},
+			}
+
+			requestedAt, requested := deployment.SyncRequest()
+
+			if requested != test.requested || (requested && requestedAt != test.annotations[SyncRequestedAtAnnotation]) {
+				t.Errorf("expected requested %t, got %q %t", test.requested, requestedAt, requested)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thalleslmF/go-operator/internal/componentspec"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"regexp"
+	"strings"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	// defaultRef is used when neither the component nor its chart url pins a ref
+	defaultRef               = "main"
+	defaultRegistry          = "docker.io"
+	defaultRegistryNamespace = "library"
+	defaultTag               = "latest"
+)
+
+// imagePattern follows the docker reference grammar: an optional registry host, told apart by a dot,
+// a port or being localhost, a lowercase repository path and an optional tag and digest
+var imagePattern = regexp.MustCompile(`^(?:(?:localhost|[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)+)(?::[0-9]+)?/|[a-zA-Z0-9-]+:[0-9]+/)?[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*(?::[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127})?(?:@sha256:[a-f0-9]{64})?$`)
+
+// log is for logging in this package.
+var charlesdeploymentlog = logf.Log.WithName("charlesdeployment-resource")
+
+func (r *CharlesDeployment) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-charlescd-io-v1-charlesdeployment,mutating=true,failurePolicy=fail,sideEffects=None,groups=charlescd.io,resources=charlesdeployments,verbs=create;update,versions=v1,name=mcharlesdeployment.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &CharlesDeployment{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *CharlesDeployment) Default() {
+	charlesdeploymentlog.Info("default", "name", r.Name)
+	for i := range r.Spec.Components {
+		r.Spec.Components[i].setDefaults(r.Namespace)
+	}
+}
+
+// setDefaults makes the provider, namespace, ref, strategy and image of the component explicit
+func (c *Component) setDefaults(namespace string) {
+	if c.Provider == "" {
+		c.Provider = componentspec.InferProvider(c.Chart)
+	}
+	if c.Namespace == "" {
+		c.Namespace = namespace
+	}
+	if c.Ref == "" && componentspec.IsSupported(c.Provider) {
+		location, err := componentspec.ParseURL(c.Provider, c.Chart)
+		if err == nil && location.Ref == "" {
+			c.Ref = defaultRef
+		}
+	}
+	if c.Strategy == "" {
+		c.Strategy = AutomaticStrategy
+	}
+	c.Image = normalizeImage(c.Image)
+}
+
+// normalizeImage spells out the registry, library namespace and tag docker assumes, nginx becoming
+// docker.io/library/nginx:latest. Images that are not valid references are left to the validation.
+func normalizeImage(image string) string {
+	if image == "" || !imagePattern.MatchString(image) {
+		return image
+	}
+	slash := strings.Index(image, "/")
+	switch {
+	case slash < 0:
+		image = fmt.Sprintf("%s/%s/%s", defaultRegistry, defaultRegistryNamespace, image)
+	case !strings.ContainsAny(image[:slash], ".:") && image[:slash] != "localhost":
+		image = fmt.Sprintf("%s/%s", defaultRegistry, image)
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	if !strings.ContainsAny(name, ":@") {
+		image = fmt.Sprintf("%s:%s", image, defaultTag)
+	}
+	return image
+}
+
+//+kubebuilder:webhook:path=/validate-charlescd-io-v1-charlesdeployment,mutating=false,failurePolicy=fail,sideEffects=None,groups=charlescd.io,resources=charlesdeployments,verbs=create;update,versions=v1,name=vcharlesdeployment.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &CharlesDeployment{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *CharlesDeployment) ValidateCreate() error {
+	charlesdeploymentlog.Info("validate create", "name", r.Name)
+	return r.toError(r.validateSpec())
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *CharlesDeployment) ValidateUpdate(old runtime.Object) error {
+	charlesdeploymentlog.Info("validate update", "name", r.Name)
+	allErrs := r.validateSpec()
+	oldDeployment, ok := old.(*CharlesDeployment)
+	if !ok {
+		return fmt.Errorf("expected a CharlesDeployment but got a %T", old)
+	}
+	allErrs = append(allErrs, r.validateImmutableFields(oldDeployment)...)
+	return r.toError(allErrs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *CharlesDeployment) ValidateDelete() error {
+	return nil
+}
+
+func (r *CharlesDeployment) toError(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("CharlesDeployment").GroupKind(), r.Name, allErrs)
+}
+
+func (r *CharlesDeployment) validateSpec() field.ErrorList {
+	var allErrs field.ErrorList
+	componentsPath := field.NewPath("spec").Child("components")
+	names := make(map[string]bool)
+	for i, component := range r.Spec.Components {
+		path := componentsPath.Index(i)
+		if names[component.Name] {
+			allErrs = append(allErrs, field.Duplicate(path.Child("name"), component.Name))
+		}
+		names[component.Name] = true
+		allErrs = append(allErrs, validateComponent(component, path)...)
+	}
+	allErrs = append(allErrs, r.validateDependencies(componentsPath)...)
+	if r.Spec.SyncInterval != nil && r.Spec.SyncInterval.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("syncInterval"), r.Spec.SyncInterval.Duration.String(), "must not be negative"))
+	}
+	return allErrs
+}
+
+// validateDependencies refuses dependencies on missing components and dependency cycles, which
+// would keep the components involved from ever being applied
+func (r *CharlesDeployment) validateDependencies(componentsPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	graph := componentspec.NewGraph()
+	for _, component := range r.Spec.Components {
+		graph.AddNode(component.Name, component.DependsOn)
+	}
+	for i, component := range r.Spec.Components {
+		for j, dependency := range component.DependsOn {
+			path := componentsPath.Index(i).Child("dependsOn").Index(j)
+			switch {
+			case dependency == component.Name:
+				allErrs = append(allErrs, field.Invalid(path, dependency, "a component may not depend on itself"))
+			case !contains(graph.Nodes(), dependency):
+				allErrs = append(allErrs, field.NotFound(path, dependency))
+			}
+		}
+	}
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+	var cycle componentspec.CycleError
+	if err := graph.Validate(); errors.As(err, &cycle) {
+		allErrs = append(allErrs, field.Invalid(componentsPath, strings.Join(cycle.Path, " -> "), "dependencies must not form a cycle"))
+	}
+	return allErrs
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func validateComponent(component Component, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if component.Name == "" {
+		allErrs = append(allErrs, field.Required(path.Child("name"), ""))
+	}
+	for _, message := range validation.IsDNS1123Label(component.Namespace) {
+		allErrs = append(allErrs, field.Invalid(path.Child("namespace"), component.Namespace, message))
+	}
+	if component.Image != "" && !imagePattern.MatchString(component.Image) {
+		allErrs = append(allErrs, field.Invalid(path.Child("image"), component.Image, "must be a valid image reference"))
+	}
+	if !componentspec.IsSupported(component.Provider) {
+		allErrs = append(allErrs, field.NotSupported(path.Child("provider"), component.Provider, componentspec.Providers))
+	} else if _, err := componentspec.ParseURL(component.Provider, component.Chart); err != nil {
+		allErrs = append(allErrs, field.Invalid(path.Child("chart"), component.Chart, err.Error()))
+	}
+	if component.Jsonnet != nil && component.Cue != nil {
+		allErrs = append(allErrs, field.Forbidden(path.Child("cue"), "may not be set together with jsonnet"))
+	}
+	for i, reference := range component.SubstituteFrom {
+		if reference.Kind != "ConfigMap" && reference.Kind != "Secret" {
+			allErrs = append(allErrs, field.NotSupported(path.Child("substituteFrom").Index(i).Child("kind"), reference.Kind, []string{"ConfigMap", "Secret"}))
+		}
+	}
+	return allErrs
+}
+
+// validateImmutableFields refuses to move an existing component to another namespace or provider,
+// which would leave its resources behind in the previous one
+func (r *CharlesDeployment) validateImmutableFields(old *CharlesDeployment) field.ErrorList {
+	var allErrs field.ErrorList
+	componentsPath := field.NewPath("spec").Child("components")
+	for i, component := range r.Spec.Components {
+		for _, oldComponent := range old.Spec.Components {
+			if oldComponent.Name != component.Name {
+				continue
+			}
+			if oldComponent.Namespace != component.Namespace {
+				allErrs = append(allErrs, field.Invalid(componentsPath.Index(i).Child("namespace"), component.Namespace, "field is immutable"))
+			}
+			if oldComponent.Provider != component.Provider {
+				allErrs = append(allErrs, field.Invalid(componentsPath.Index(i).Child("provider"), component.Provider, "field is immutable"))
+			}
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,128 @@
+package v1
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func validComponent(name string) Component {
+	return Component{
+		Name:      name,
+		Image:     "thallesf/quiz-app:1.0",
+		Chart:     "https://github.com/thallesfreitaszup/kustomize-demo//overlays/dev",
+		Provider:  "GITHUB",
+		Namespace: "default",
+	}
+}
+
+func charlesDeployment(name string, components ...Component) *CharlesDeployment {
+	return &CharlesDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       CharlesDeploymentSpec{Components: components},
+	}
+}
+
+var _ = Describe("CharlesDeployment validating webhook", func() {
+	It("admits a valid spec", func() {
+		deployment := charlesDeployment("valid", validComponent("backend"), validComponent("frontend"))
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+	})
+
+	It("rejects duplicate component names", func() {
+		deployment := charlesDeployment("duplicate", validComponent("backend"), validComponent("backend"))
+		err := k8sClient.Create(ctx, deployment)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.components[1].name"))
+	})
+
+	It("rejects unknown providers", func() {
+		component := validComponent("backend")
+		component.Provider = "SVN"
+		err := k8sClient.Create(ctx, charlesDeployment("provider", component))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.components[0].provider"))
+	})
+
+	It("rejects unparsable repository urls", func() {
+		component := validComponent("backend")
+		component.Chart = "https://github.com/only-owner"
+		err := k8sClient.Create(ctx, charlesDeployment("chart", component))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.components[0].chart"))
+	})
+
+	It("rejects malformed images", func() {
+		component := validComponent("backend")
+		component.Image = "Thallesf/Quiz App:1.0"
+		err := k8sClient.Create(ctx, charlesDeployment("image", component))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.components[0].image"))
+	})
+
+	It("rejects dependencies on unknown components", func() {
+		component := validComponent("backend")
+		component.DependsOn = []string{"database"}
+		err := k8sClient.Create(ctx, charlesDeployment("unknown-dependency", component))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.components[0].dependsOn[0]"))
+	})
+
+	It("rejects dependency cycles", func() {
+		backend := validComponent("backend")
+		backend.DependsOn = []string{"frontend"}
+		frontend := validComponent("frontend")
+		frontend.DependsOn = []string{"backend"}
+		err := k8sClient.Create(ctx, charlesDeployment("cycle", backend, frontend))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("backend -> frontend -> backend"))
+	})
+
+	It("rejects moving a component to another namespace", func() {
+		deployment := charlesDeployment("immutable", validComponent("backend"))
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		deployment.Spec.Components[0].Namespace = "other"
+		err := k8sClient.Update(ctx, deployment)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("field is immutable"))
+	})
+
+	It("allows adding components on update", func() {
+		deployment := charlesDeployment("update", validComponent("backend"))
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		deployment.Spec.Components = append(deployment.Spec.Components, validComponent("frontend"))
+		Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+	})
+})
+
+var _ = Describe("CharlesDeployment defaulting webhook", func() {
+	It("makes the component fields explicit", func() {
+		deployment := charlesDeployment("defaults", Component{
+			Name:  "backend",
+			Image: "nginx",
+			Chart: "https://github.com/thallesfreitaszup/kustomize-demo//overlays/dev",
+		})
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		component := deployment.Spec.Components[0]
+		Expect(component.Provider).To(Equal("GITHUB"))
+		Expect(component.Namespace).To(Equal("default"))
+		Expect(component.Ref).To(Equal("main"))
+		Expect(component.Strategy).To(Equal(AutomaticStrategy))
+		Expect(component.Image).To(Equal("docker.io/library/nginx:latest"))
+	})
+
+	It("keeps the ref pinned in the chart url and explicit images", func() {
+		component := validComponent("backend")
+		component.Chart = "https://github.com/thallesfreitaszup/kustomize-demo//overlays/dev?ref=v1.0.0"
+		component.Image = "quay.io/thallesf/quiz-app:1.0"
+		deployment := charlesDeployment("explicit", component)
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		Expect(deployment.Spec.Components[0].Ref).To(BeEmpty())
+		Expect(deployment.Spec.Components[0].Image).To(Equal("quay.io/thallesf/quiz-app:1.0"))
+	})
+})
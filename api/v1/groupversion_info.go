@@ -14,9 +14,9 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Package v1beta1 contains API Schema definitions for the io.charlescd v1beta1 API group
+// Package v1 contains API Schema definitions for the charlescd v1 API group
 //+kubebuilder:object:generate=true
-//+groupName=io.charlescd.my.domain
+//+groupName=charlescd.io
 package v1
 
 import (
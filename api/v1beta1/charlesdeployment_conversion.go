@@ -0,0 +1,126 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+	v1 "github.com/thalleslmF/go-operator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// hubAnnotation keeps the v1 spec fields v1beta1 can not represent, so they survive a round trip.
+// The status is not kept, the operator reading and writing it through v1.
+const hubAnnotation = "conversion.charlescd.io/v1"
+
+// hubFields are the parts of a v1 CharlesDeployment kept in hubAnnotation, the components only
+// holding their name and the fields v1beta1 has no equivalent for
+type hubFields struct {
+	Spec v1.CharlesDeploymentSpec `json:"spec"`
+}
+
+var _ conversion.Convertible = &CharlesDeployment{}
+
+// ConvertTo converts this CharlesDeployment to the v1 hub, restoring the v1 only fields
+// saved by ConvertFrom. Fields v1beta1 holds take precedence over the saved ones. Components
+// setting a token are rejected rather than stored on the object without it, the token must be
+// moved to a Secret referenced by the v1 secretRef.
+func (src *CharlesDeployment) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1.CharlesDeployment)
+	if !ok {
+		return fmt.Errorf("expected a v1 CharlesDeployment but got a %T", dstRaw)
+	}
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	saved := hubFields{}
+	if value, ok := src.Annotations[hubAnnotation]; ok {
+		err := json.Unmarshal([]byte(value), &saved)
+		if err != nil {
+			return fmt.Errorf("error reading the %s annotation: %w", hubAnnotation, err)
+		}
+		delete(dst.Annotations, hubAnnotation)
+	}
+	dst.Spec = saved.Spec
+	dst.Spec.Components = nil
+	dst.Status = v1.CharlesDeploymentStatus{}
+
+	for _, component := range src.Spec.Components {
+		if component.Token != "" {
+			return fmt.Errorf("component %s sets token, which is not converted: store it under the token key of a Secret and reference it with the secretRef of %s", component.Name, v1.GroupVersion)
+		}
+		hubComponent := v1.Component{}
+		for _, savedComponent := range saved.Spec.Components {
+			if savedComponent.Name == component.Name {
+				hubComponent = savedComponent
+			}
+		}
+		hubComponent.Name = component.Name
+		hubComponent.Image = component.Image
+		hubComponent.Chart = component.Chart
+		hubComponent.Provider = component.Provider
+		hubComponent.Namespace = component.Namespace
+		hubComponent.ChildResources = nil
+		for _, child := range component.ChildResources {
+			hubComponent.ChildResources = append(hubComponent.ChildResources, v1.Child(child))
+		}
+		dst.Spec.Components = append(dst.Spec.Components, hubComponent)
+	}
+	return nil
+}
+
+// ConvertFrom converts the v1 hub to this CharlesDeployment, saving what v1beta1 can not represent in an annotation
+func (dst *CharlesDeployment) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1.CharlesDeployment)
+	if !ok {
+		return fmt.Errorf("expected a v1 CharlesDeployment but got a %T", srcRaw)
+	}
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec.Components = nil
+	for _, component := range src.Spec.Components {
+		spokeComponent := Component{
+			Name:      component.Name,
+			Image:     component.Image,
+			Chart:     component.Chart,
+			Provider:  component.Provider,
+			Namespace: component.Namespace,
+		}
+		for _, child := range component.ChildResources {
+			spokeComponent.ChildResources = append(spokeComponent.ChildResources, Child(child))
+		}
+		dst.Spec.Components = append(dst.Spec.Components, spokeComponent)
+	}
+	saved := *src.Spec.DeepCopy()
+	for i := range saved.Components {
+		saved.Components[i].Image = ""
+		saved.Components[i].Chart = ""
+		saved.Components[i].Provider = ""
+		saved.Components[i].Namespace = ""
+		saved.Components[i].ChildResources = nil
+	}
+	value, err := json.Marshal(hubFields{Spec: saved})
+	if err != nil {
+		return err
+	}
+	setAnnotation(&dst.ObjectMeta.Annotations, hubAnnotation, string(value))
+	return nil
+}
+
+func setAnnotation(annotations *map[string]string, key string, value string) {
+	if *annotations == nil {
+		*annotations = make(map[string]string)
+	}
+	(*annotations)[key] = value
+}
@@ -0,0 +1,92 @@
+package v1beta1
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/thalleslmF/go-operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConvertHubRoundTrip(t *testing.T) {
+	hub := &v1.CharlesDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "deploy", Namespace: "dev", Annotations: map[string]string{"team": "quiz"}},
+		Spec: v1.CharlesDeploymentSpec{
+			SyncInterval: &metav1.Duration{Duration: 300000000000},
+			Components: []v1.Component{{
+				Name:           "backend",
+				Image:          "docker.io/thallesf/quiz-app:1.0",
+				Chart:          "https://github.com/thallesfreitaszup/kustomize-demo//overlays/dev",
+				Provider:       "GITHUB",
+				Namespace:      "dev",
+				Ref:            "main",
+				SecretRef:      "github",
+				NamePrefix:     "dev-",
+				ChildResources: []v1.Child{{ApiVersion: "apps/v1", Name: "backend", Plural: "deployments"}},
+			}},
+		},
+	}
+	spoke := &CharlesDeployment{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if spoke.Spec.Components[0].ChildResources[0].Plural != "deployments" {
+		t.Fatalf("child resources were not converted: %+v", spoke.Spec.Components[0])
+	}
+	converted := &v1.CharlesDeployment{}
+	if err := spoke.ConvertTo(converted); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hub, converted) {
+		t.Fatalf("round trip lost data:\n%+v\n%+v", hub, converted)
+	}
+}
+
+func TestConvertFromOnlySavesFieldsV1beta1CanNotRepresent(t *testing.T) {
+	hub := &v1.CharlesDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "deploy", Namespace: "dev"},
+		Spec: v1.CharlesDeploymentSpec{Components: []v1.Component{{
+			Name:      "backend",
+			Image:     "docker.io/thallesf/quiz-app:1.0",
+			Chart:     "https://github.com/thallesfreitaszup/kustomize-demo//overlays/dev",
+			Provider:  "GITHUB",
+			Namespace: "dev",
+			Ref:       "main",
+		}}},
+		Status: v1.CharlesDeploymentStatus{Components: []v1.ComponentStatus{{Name: "backend", Revision: "abc"}}},
+	}
+	spoke := &CharlesDeployment{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	saved := spoke.Annotations[hubAnnotation]
+	for _, value := range []string{"kustomize-demo", "quiz-app", "abc"} {
+		if strings.Contains(saved, value) {
+			t.Errorf("expected %s not to be saved in %s", value, saved)
+		}
+	}
+	if !strings.Contains(saved, `"ref":"main"`) {
+		t.Errorf("expected the v1 only ref to be saved in %s", saved)
+	}
+}
+
+func TestConvertSpokeRejectsTokens(t *testing.T) {
+	spoke := &CharlesDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "deploy", Namespace: "dev"},
+		Spec: CharlesDeploymentSpec{Components: []Component{{
+			Name:      "backend",
+			Image:     "thallesf/quiz-app:1.0",
+			Chart:     "https://github.com/thallesfreitaszup/kustomize-demo//overlays/dev",
+			Provider:  "GITHUB",
+			Namespace: "dev",
+			Token:     "secret",
+		}}},
+	}
+
+	err := spoke.ConvertTo(&v1.CharlesDeployment{})
+
+	if err == nil || !strings.Contains(err.Error(), "component backend sets token") || !strings.Contains(err.Error(), "secretRef") {
+		t.Fatalf("expected the token to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CharlesDeploymentSpec defines the desired state of CharlesDeployment
+type CharlesDeploymentSpec struct {
+	Components []Component `json:"components,omitempty"`
+}
+
+// CharlesDeploymentStatus defines the observed state of CharlesDeployment
+type CharlesDeploymentStatus struct {
+}
+
+// Component is the first shape of a component, whose chart is a kustomize remote url fetched with Token
+type Component struct {
+	Name      string `json:"name"`
+	Image     string `json:"image"`
+	Chart     string `json:"chart"`
+	Provider  string `json:"provider"`
+	Namespace string `json:"namespace"`
+	// Token is the provider token, replaced by the v1 secretRef. Objects setting it are rejected.
+	Token          string  `json:"token,omitempty"`
+	ChildResources []Child `json:"child_resources,omitempty"`
+}
+
+type Child struct {
+	ApiVersion    string `json:"apiVersion,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Plural        string `json:"plural,omitempty"`
+	ComponentName string `json:"componentName,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=cd
+
+// CharlesDeployment is the Schema for the charlesdeployments API
+type CharlesDeployment struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CharlesDeploymentSpec   `json:"spec,omitempty"`
+	Status CharlesDeploymentStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CharlesDeploymentList contains a list of CharlesDeployment
+type CharlesDeploymentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CharlesDeployment `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CharlesDeployment{}, &CharlesDeploymentList{})
+}
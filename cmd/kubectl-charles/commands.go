@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
+	"github.com/thalleslmF/go-operator/internal/common"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+// syncNow sets the sync-requested-at annotation, the operator applying every component again once
+func syncNow(ctx context.Context, clients clients, args []string) error {
+	requestedAt := time.Now().UTC().Format(time.RFC3339Nano)
+	err := patch(ctx, clients, args[0], map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{iocharlescdv1.SyncRequestedAtAnnotation: requestedAt},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("charlesdeployment/%s sync requested at %s\n", args[0], requestedAt)
+	return nil
+}
+
+func suspend(ctx context.Context, clients clients, args []string) error {
+	err := patch(ctx, clients, args[0], map[string]interface{}{
+		"spec": map[string]interface{}{"suspend": true},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("charlesdeployment/%s suspended\n", args[0])
+	return nil
+}
+
+// resume clears spec.suspend and removes the reconcile annotation
+func resume(ctx context.Context, clients clients, args []string) error {
+	err := patch(ctx, clients, args[0], map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{iocharlescdv1.ReconcileAnnotation: nil},
+		},
+		"spec": map[string]interface{}{"suspend": false},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("charlesdeployment/%s resumed\n", args[0])
+	return nil
+}
+
+// rollback pins the component ref to a commit, which the operator renders on its next sync. The
+// patch tests the resourceVersion the component was found at, failing if the deployment changed since.
+func rollback(ctx context.Context, clients clients, args []string) error {
+	name, componentName, revision := args[0], args[1], args[2]
+	deployment := iocharlescdv1.CharlesDeployment{}
+	err := clients.Client.Get(ctx, client.ObjectKey{Namespace: clients.Namespace, Name: name}, &deployment)
+	if err != nil {
+		return err
+	}
+	index := -1
+	for i, component := range deployment.Spec.Components {
+		if component.Name == componentName {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("%s has no component %s", name, componentName)
+	}
+	data, err := json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": "/metadata/resourceVersion", "value": deployment.ResourceVersion},
+		{"op": "add", "path": fmt.Sprintf("/spec/components/%d/ref", index), "value": revision},
+	})
+	if err != nil {
+		return err
+	}
+	err = clients.Client.Patch(ctx, &deployment, client.RawPatch(types.JSONPatchType, data))
+	if err != nil {
+		return fmt.Errorf("error rolling back %s, it may have changed since it was read: %w", name, err)
+	}
+	fmt.Printf("charlesdeployment/%s component %s rolled back to %s\n", name, componentName, revision)
+	return nil
+}
+
+// promote applies the pending revision of a Manual component
+func promote(ctx context.Context, clients clients, args []string) error {
+	revision, err := annotatePendingRevision(ctx, clients, args[0], args[1], iocharlescdv1.PromoteAnnotationPrefix)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("charlesdeployment/%s component %s promoted to %s\n", args[0], args[1], revision)
+	return nil
+}
+
+// abort keeps a Manual component at its applied revision, ignoring the pending one
+func abort(ctx context.Context, clients clients, args []string) error {
+	revision, err := annotatePendingRevision(ctx, clients, args[0], args[1], iocharlescdv1.AbortAnnotationPrefix)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("charlesdeployment/%s component %s rollout of %s aborted\n", args[0], args[1], revision)
+	return nil
+}
+
+// annotatePendingRevision sets the annotation with prefix of a Manual component to its pending revision. The
+// patch carries the resourceVersion the revision was read at, failing if the deployment changed since.
+func annotatePendingRevision(ctx context.Context, clients clients, name string, componentName string, prefix string) (string, error) {
+	deployment := iocharlescdv1.CharlesDeployment{}
+	err := clients.Client.Get(ctx, client.ObjectKey{Namespace: clients.Namespace, Name: name}, &deployment)
+	if err != nil {
+		return "", err
+	}
+	var component *iocharlescdv1.Component
+	for i := range deployment.Spec.Components {
+		if deployment.Spec.Components[i].Name == componentName {
+			component = &deployment.Spec.Components[i]
+		}
+	}
+	if component == nil {
+		return "", fmt.Errorf("%s has no component %s", name, componentName)
+	}
+	if component.Strategy != iocharlescdv1.ManualStrategy {
+		return "", fmt.Errorf("component %s of %s is not rolled out with the %s strategy", componentName, name, iocharlescdv1.ManualStrategy)
+	}
+	status := common.FindComponentStatus(deployment.Status, componentName)
+	if status == nil || status.PendingRevision == "" {
+		return "", fmt.Errorf("component %s of %s has no pending revision", componentName, name)
+	}
+	err = patch(ctx, clients, name, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": deployment.ResourceVersion,
+			"annotations":     map[string]interface{}{prefix + componentName: status.PendingRevision},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error annotating %s, it may have changed since it was read: %w", name, err)
+	}
+	return status.PendingRevision, nil
+}
+
+func patch(ctx context.Context, clients clients, name string, fields map[string]interface{}) error {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	deployment := iocharlescdv1.CharlesDeployment{}
+	deployment.Namespace = clients.Namespace
+	deployment.Name = name
+	return clients.Client.Patch(ctx, &deployment, client.RawPatch(types.MergePatchType, data))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"flag"
+	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+)
+
+func testClients(objects ...client.Object) clients {
+	return clients{
+		Client:    fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		Namespace: "default",
+	}
+}
+
+func testDeployment() *iocharlescdv1.CharlesDeployment {
+	return &iocharlescdv1.CharlesDeployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: iocharlescdv1.CharlesDeploymentSpec{
+			Components: []iocharlescdv1.Component{{Name: "api"}, {Name: "web", Ref: "main"}},
+		},
+	}
+}
+
+func getDeployment(t *testing.T, clients clients) iocharlescdv1.CharlesDeployment {
+	deployment := iocharlescdv1.CharlesDeployment{}
+	err := clients.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "app"}, &deployment)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return deployment
+}
+
+func TestRollback(t *testing.T) {
+	tests := []struct {
+		name      string
+		component string
+		expected  []string
+		err       bool
+	}{
+		{name: "component without ref", component: "api", expected: []string{"abc123", "main"}},
+		{name: "component with ref", component: "web", expected: []string{"", "abc123"}},
+		{name: "unknown component", component: "worker", expected: []string{"", "main"}, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clients := testClients(testDeployment())
+
+			err := rollback(context.Background(), clients, []string{"app", test.component, "abc123"})
+
+			if test.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", test.err, err)
+			}
+			var refs []string
+			for _, component := range getDeployment(t, clients).Spec.Components {
+				refs = append(refs, component.Ref)
+			}
+			if !reflect.DeepEqual(refs, test.expected) {
+				t.Errorf("expected refs %v, got %v", test.expected, refs)
+			}
+		})
+	}
+}
+
+// concurrentClient updates the deployment between the Get and the Patch of a command
+type concurrentClient struct {
+	client.Client
+}
+
+func (c concurrentClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	deployment := iocharlescdv1.CharlesDeployment{}
+	err := c.Client.Get(ctx, client.ObjectKeyFromObject(obj), &deployment)
+	if err != nil {
+		return err
+	}
+	deployment.Spec.Components = deployment.Spec.Components[1:]
+	err = c.Client.Update(ctx, &deployment)
+	if err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestRollbackFailsOnConcurrentChange(t *testing.T) {
+	clients := testClients(testDeployment())
+	clients.Client = concurrentClient{clients.Client}
+
+	err := rollback(context.Background(), clients, []string{"app", "api", "abc123"})
+
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	components := getDeployment(t, clients).Spec.Components
+	if len(components) != 1 || components[0].Name != "web" || components[0].Ref != "main" {
+		t.Errorf("expected the concurrent change to be kept, got %+v", components)
+	}
+}
+
+// manualDeployment has a Manual web component whose ref moved to revision def456
+func manualDeployment() *iocharlescdv1.CharlesDeployment {
+	deployment := testDeployment()
+	deployment.Spec.Components[1].Strategy = iocharlescdv1.ManualStrategy
+	deployment.Status.Components = []iocharlescdv1.ComponentStatus{
+		{Name: "api", Revision: "abc123"},
+		{Name: "web", Revision: "abc123", PendingRevision: "def456"},
+	}
+	return deployment
+}
+
+func TestPromoteAndAbort(t *testing.T) {
+	tests := []struct {
+		name       string
+		command    func(ctx context.Context, clients clients, args []string) error
+		component  string
+		annotation string
+		err        bool
+	}{
+		{name: "promote", command: promote, component: "web", annotation: iocharlescdv1.PromoteAnnotationPrefix + "web"},
+		{name: "abort", command: abort, component: "web", annotation: iocharlescdv1.AbortAnnotationPrefix + "web"},
+		{name: "automatic component", command: promote, component: "api", err: true},
+		{name: "unknown component", command: abort, component: "worker", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clients := testClients(manualDeployment())
+
+			err := test.command(context.Background(), clients, []string{"app", test.component})
+
+			if test.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", test.err, err)
+			}
+			annotations := getDeployment(t, clients).Annotations
+			if test.annotation != "" && annotations[test.annotation] != "def456" {
+				t.Errorf("expected %s to be set to the pending revision, got %v", test.annotation, annotations)
+			}
+			if test.err && len(annotations) > 0 {
+				t.Errorf("expected no annotation, got %v", annotations)
+			}
+		})
+	}
+}
+
+func TestPromoteWithoutPendingRevision(t *testing.T) {
+	deployment := manualDeployment()
+	deployment.Status.Components[1].PendingRevision = ""
+	clients := testClients(deployment)
+
+	err := promote(context.Background(), clients, []string{"app", "web"})
+
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestPromoteFailsOnConcurrentChange(t *testing.T) {
+	clients := testClients(manualDeployment())
+	clients.Client = concurrentClient{clients.Client}
+
+	err := promote(context.Background(), clients, []string{"app", "web"})
+
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if annotations := getDeployment(t, clients).Annotations; len(annotations) > 0 {
+		t.Errorf("expected no annotation, got %v", annotations)
+	}
+}
+
+func TestSuspendAndResume(t *testing.T) {
+	deployment := testDeployment()
+	deployment.Annotations = map[string]string{iocharlescdv1.ReconcileAnnotation: "disabled"}
+	clients := testClients(deployment)
+
+	err := suspend(context.Background(), clients, []string{"app"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !getDeployment(t, clients).Spec.Suspend {
+		t.Errorf("expected the deployment to be suspended")
+	}
+
+	err = resume(context.Background(), clients, []string{"app"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resumed := getDeployment(t, clients)
+	if _, ok := resumed.Annotations[iocharlescdv1.ReconcileAnnotation]; resumed.Spec.Suspend || ok {
+		t.Errorf("expected the deployment to be resumed, got suspend %t and annotations %v", resumed.Spec.Suspend, resumed.Annotations)
+	}
+}
+
+func TestSyncNowRequestsSync(t *testing.T) {
+	clients := testClients(testDeployment())
+
+	err := syncNow(context.Background(), clients, []string{"app"})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if getDeployment(t, clients).Annotations[iocharlescdv1.SyncRequestedAtAnnotation] == "" {
+		t.Errorf("expected the sync requested at annotation to be set")
+	}
+}
+
+func TestParseInterleaved(t *testing.T) {
+	flags := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	namespace := flags.String("n", "", "")
+
+	args := parseInterleaved(flags, []string{"app", "-n", "prod", "api", "abc123"})
+
+	if !reflect.DeepEqual(args, []string{"app", "api", "abc123"}) || *namespace != "prod" {
+		t.Errorf("expected the positional arguments and namespace flag, got %v and %q", args, *namespace)
+	}
+}
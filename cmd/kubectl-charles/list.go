@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
+	"github.com/thalleslmF/go-operator/internal/common"
+	"os"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+	"text/tabwriter"
+)
+
+var allNamespaces bool
+
+func listFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&allNamespaces, "all-namespaces", false, "List the deployments of every namespace.")
+	flags.BoolVar(&allNamespaces, "A", false, "Shorthand for --all-namespaces.")
+}
+
+// list prints a row per component of each deployment with the revision it runs and why it is not ready
+func list(ctx context.Context, clients clients, _ []string) error {
+	deployments := iocharlescdv1.CharlesDeploymentList{}
+	var options []client.ListOption
+	if !allNamespaces {
+		options = append(options, client.InNamespace(clients.Namespace))
+	}
+	err := clients.Client.List(ctx, &deployments, options...)
+	if err != nil {
+		return err
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAMESPACE\tNAME\tCOMPONENT\tREADY\tREVISION\tPENDING\tLAST SYNC\tMESSAGE")
+	for _, deployment := range deployments.Items {
+		if deployment.IsSuspended() {
+			fmt.Fprintf(writer, "%s\t%s\t\tSuspended\t\t\t\t\n", deployment.Namespace, deployment.Name)
+		}
+		for _, component := range deployment.Spec.Components {
+			ready, revision, pending, lastSync, message := "Unknown", "", "", "", ""
+			if status := common.FindComponentStatus(deployment.Status, component.Name); status != nil {
+				ready = fmt.Sprint(status.Ready)
+				revision = shortRevision(status.Revision)
+				pending = shortRevision(status.PendingRevision)
+				if !status.LastSyncTime.IsZero() {
+					lastSync = status.LastSyncTime.Format("2006-01-02 15:04:05")
+				}
+				message = strings.ReplaceAll(status.Message, "\n", " ")
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", deployment.Namespace, deployment.Name, component.Name, ready, revision, pending, lastSync, message)
+		}
+	}
+	return writer.Flush()
+}
+
+func shortRevision(revision string) string {
+	if len(revision) > 12 {
+		return revision[:12]
+	}
+	return revision
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-charles is a kubectl plugin to inspect and operate CharlesDeployments
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"os"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+)
+
+const usage = `kubectl charles manages CharlesDeployments.
+
+Usage:
+  kubectl charles list [-A]                           List deployments with the health of their components
+  kubectl charles tree NAME                           Show the resources owned by a deployment
+  kubectl charles sync NAME                           Apply every component again now
+  kubectl charles suspend NAME                        Suspend the reconciliation
+  kubectl charles resume NAME                         Resume the reconciliation
+  kubectl charles promote NAME COMPONENT              Apply the pending revision of a Manual component
+  kubectl charles abort NAME COMPONENT                Keep a Manual component at its revision, ignoring the pending one
+  kubectl charles rollback NAME COMPONENT REVISION    Pin a component to a commit, held as pending for Manual ones
+  kubectl charles render NAME COMPONENT               Render a component locally as the operator would
+
+Every command accepts --kubeconfig, --context and -n/--namespace.
+`
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(iocharlescdv1.AddToScheme(scheme))
+}
+
+// command runs a subcommand with its positional arguments
+type command struct {
+	args  int
+	run   func(ctx context.Context, clients clients, args []string) error
+	flags func(flags *flag.FlagSet)
+}
+
+var commands = map[string]command{
+	"list":     {args: 0, run: list, flags: listFlags},
+	"tree":     {args: 1, run: tree},
+	"sync":     {args: 1, run: syncNow},
+	"suspend":  {args: 1, run: suspend},
+	"resume":   {args: 1, run: resume},
+	"promote":  {args: 2, run: promote},
+	"abort":    {args: 2, run: abort},
+	"rollback": {args: 3, run: rollback},
+	"render":   {args: 2, run: render, flags: renderFlags},
+}
+
+// clients reach the cluster of the kubeconfig context, Namespace being the one the command targets
+type clients struct {
+	Client    client.Client
+	Dynamic   dynamic.Interface
+	Discovery discovery.DiscoveryInterface
+	Namespace string
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	var kubeconfig, kubeContext, namespace string
+	flags.StringVar(&kubeconfig, "kubeconfig", "", "The kubeconfig file, defaulting to $KUBECONFIG or ~/.kube/config.")
+	flags.StringVar(&kubeContext, "context", "", "The kubeconfig context to use.")
+	flags.StringVar(&namespace, "namespace", "", "The namespace of the deployments, defaulting to the one of the context.")
+	flags.StringVar(&namespace, "n", "", "Shorthand for --namespace.")
+	if cmd.flags != nil {
+		cmd.flags(flags)
+	}
+	args := parseInterleaved(flags, os.Args[2:])
+	if len(args) != cmd.args {
+		fmt.Fprintf(os.Stderr, "%s expects %d arguments but got %d\n\n%s", name, cmd.args, len(args), usage)
+		os.Exit(2)
+	}
+	clients, err := newClients(kubeconfig, kubeContext, namespace)
+	if err == nil {
+		err = cmd.run(context.Background(), clients, args)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// parseInterleaved parses the flags wherever they are, like kubectl, returning the positional arguments
+func parseInterleaved(flags *flag.FlagSet, arguments []string) []string {
+	var args []string
+	for {
+		_ = flags.Parse(arguments)
+		if flags.NArg() == 0 {
+			return args
+		}
+		args = append(args, flags.Arg(0))
+		arguments = flags.Args()[1:]
+	}
+}
+
+func newClients(kubeconfig string, kubeContext string, namespace string) (clients, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{
+		CurrentContext: kubeContext,
+		Context:        clientcmdapi.Context{Namespace: namespace},
+	})
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return clients{}, err
+	}
+	namespace, _, err = clientConfig.Namespace()
+	if err != nil {
+		return clients{}, err
+	}
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return clients{}, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return clients{}, err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return clients{}, err
+	}
+	return clients{Client: c, Dynamic: dynamicClient, Discovery: discoveryClient, Namespace: namespace}, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
+	"github.com/thalleslmF/go-operator/internal/controllers"
+	"github.com/thalleslmF/go-operator/internal/options"
+	"github.com/thalleslmF/go-operator/internal/sourcecache"
+	"io/ioutil"
+	"os"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+var renderOptions options.Render
+
+// renderFlags are the source and kustomize flags of the operator, which the components are rendered with
+func renderFlags(flags *flag.FlagSet) {
+	renderOptions.BindFlags(flags)
+}
+
+// render downloads and renders the component with the code of the operator, reading its credentials
+// and substitution variables from the cluster, and prints the manifests it would apply
+func render(ctx context.Context, clients clients, args []string) error {
+	deployment := iocharlescdv1.CharlesDeployment{}
+	err := clients.Client.Get(ctx, client.ObjectKey{Namespace: clients.Namespace, Name: args[0]}, &deployment)
+	if err != nil {
+		return err
+	}
+	err = renderOptions.Complete()
+	if err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", "kubectl-charles")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	sourceCache, err := sourcecache.New(dir, 0)
+	if err != nil {
+		return err
+	}
+	renderer := &controllers.CharlesDeploymentController{
+		Client:            clients.Client,
+		SourceCache:       sourceCache,
+		RepositoryOptions: renderOptions.Repository,
+		KustomizeOptions:  renderOptions.Kustomize,
+	}
+	objects, revision, err := renderer.RenderComponent(ctx, deployment, args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("# %s/%s rendered at %s\n", deployment.Name, args[1], revision)
+	for _, object := range objects {
+		content, err := yaml.Marshal(object.Object)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("---\n%s", content)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+	"strings"
+)
+
+// tree prints the objects owned by the deployment, and the ones they own in turn, found by listing
+// every kind the user may list in the namespaces of the deployment and its components
+func tree(ctx context.Context, clients clients, args []string) error {
+	deployment := iocharlescdv1.CharlesDeployment{}
+	err := clients.Client.Get(ctx, client.ObjectKey{Namespace: clients.Namespace, Name: args[0]}, &deployment)
+	if err != nil {
+		return err
+	}
+	namespaces := map[string]bool{deployment.Namespace: true}
+	for _, component := range deployment.Spec.Components {
+		if component.Namespace != "" {
+			namespaces[component.Namespace] = true
+		}
+	}
+	children, err := listOwned(ctx, clients, namespaces)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("CharlesDeployment/%s\n", deployment.Name)
+	printChildren(children, deployment.UID, "")
+	return nil
+}
+
+// listOwned lists the objects having an owner, indexed by the UID of their owners
+func listOwned(ctx context.Context, clients clients, namespaces map[string]bool) (map[types.UID][]unstructured.Unstructured, error) {
+	resourceLists, err := clients.Discovery.ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	children := make(map[types.UID][]unstructured.Unstructured)
+	for _, resourceList := range resourceLists {
+		groupVersion, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resourceList.APIResources {
+			if !isListable(resource) {
+				continue
+			}
+			gvr := groupVersion.WithResource(resource.Name)
+			var lists []*unstructured.UnstructuredList
+			if resource.Namespaced {
+				for namespace := range namespaces {
+					list, err := clients.Dynamic.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+					if apierrors.IsForbidden(err) {
+						continue
+					}
+					if err != nil {
+						return nil, fmt.Errorf("error listing %s: %w", gvr, err)
+					}
+					lists = append(lists, list)
+				}
+			} else {
+				list, err := clients.Dynamic.Resource(gvr).List(ctx, metav1.ListOptions{})
+				if apierrors.IsForbidden(err) {
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("error listing %s: %w", gvr, err)
+				}
+				lists = append(lists, list)
+			}
+			for _, list := range lists {
+				for _, item := range list.Items {
+					for _, owner := range item.GetOwnerReferences() {
+						children[owner.UID] = append(children[owner.UID], item)
+					}
+				}
+			}
+		}
+	}
+	return children, nil
+}
+
+func isListable(resource metav1.APIResource) bool {
+	if strings.Contains(resource.Name, "/") {
+		return false
+	}
+	for _, verb := range resource.Verbs {
+		if verb == "list" {
+			return true
+		}
+	}
+	return false
+}
+
+func printChildren(children map[types.UID][]unstructured.Unstructured, owner types.UID, indent string) {
+	owned := children[owner]
+	sort.SliceStable(owned, func(i, j int) bool {
+		if owned[i].GetKind() != owned[j].GetKind() {
+			return owned[i].GetKind() < owned[j].GetKind()
+		}
+		return owned[i].GetName() < owned[j].GetName()
+	})
+	for i, child := range owned {
+		branch, nextIndent := "├── ", indent+"│   "
+		if i == len(owned)-1 {
+			branch, nextIndent = "└── ", indent+"    "
+		}
+		fmt.Printf("%s%s%s/%s%s\n", indent, branch, child.GetKind(), child.GetName(), describe(child))
+		printChildren(children, child.GetUID(), nextIndent)
+	}
+}
+
+// describe returns the namespace and Ready condition of the object, when it has them
+func describe(object unstructured.Unstructured) string {
+	var details []string
+	if object.GetNamespace() != "" {
+		details = append(details, "namespace="+object.GetNamespace())
+	}
+	conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+	for _, item := range conditions {
+		fields, ok := item.(map[string]interface{})
+		if ok && (fields["type"] == "Ready" || fields["type"] == "Available") {
+			details = append(details, fmt.Sprintf("%s=%v", fields["type"], fields["status"]))
+		}
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(details, ", ") + ")"
+}
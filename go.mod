@@ -3,16 +3,20 @@ module github.com/thalleslmF/go-operator
 go 1.16
 
 require (
+	cuelang.org/go v0.4.3
+	github.com/google/go-jsonnet v0.17.0
 	github.com/onsi/ginkgo v1.16.4
 	github.com/onsi/gomega v1.15.0
+	github.com/prometheus/client_golang v1.11.0
 	github.com/prometheus/common v0.26.0
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
 	gopkg.in/resty.v1 v1.12.0
+	k8s.io/api v0.22.1
 	k8s.io/apimachinery v0.22.1
 	k8s.io/client-go v0.22.1
 	k8s.io/utils v0.0.0-20210802155522-efc7438f0176
 	sigs.k8s.io/controller-runtime v0.10.0
 	sigs.k8s.io/kustomize/api v0.10.1
-	sigs.k8s.io/kustomize/kustomize/v4 v4.4.1
 	sigs.k8s.io/kustomize/kyaml v0.13.0
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -1,12 +1,16 @@
 package common
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/utils/pointer"
+	"sort"
 	"strings"
 )
 
@@ -29,3 +33,109 @@ func GetGroupVersion(resource unstructured.Unstructured) schema.GroupVersionReso
 
 	return schema.GroupVersionResource{Version: resource.GroupVersionKind().Version, Group: resource.GroupVersionKind().Group, Resource: plural}
 }
+
+// HashComponent returns a stable hash of the component spec and substitution variables, used to detect changes between syncs
+func HashComponent(component iocharlescdv1.Component, variables map[string]string) (string, error) {
+	componentBytes, err := json.Marshal(struct {
+		Component iocharlescdv1.Component
+		Variables map[string]string
+	}{component, variables})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(componentBytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SubstitutionEnabled tells whether the rendered manifests of the component go through variable substitution
+func SubstitutionEnabled(component iocharlescdv1.Component) bool {
+	return component.Substitute != nil || len(component.SubstituteFrom) > 0 || component.SubstituteStrict
+}
+
+func FindComponentStatus(status iocharlescdv1.CharlesDeploymentStatus, name string) *iocharlescdv1.ComponentStatus {
+	for i := range status.Components {
+		if status.Components[i].Name == name {
+			return &status.Components[i]
+		}
+	}
+	return nil
+}
+
+func SetComponentStatus(status *iocharlescdv1.CharlesDeploymentStatus, componentStatus iocharlescdv1.ComponentStatus) {
+	for i := range status.Components {
+		if status.Components[i].Name == componentStatus.Name {
+			status.Components[i] = componentStatus
+			return
+		}
+	}
+	status.Components = append(status.Components, componentStatus)
+}
+
+func RemoveComponentStatus(status *iocharlescdv1.CharlesDeploymentStatus, name string) {
+	for i := range status.Components {
+		if status.Components[i].Name == name {
+			status.Components = append(status.Components[:i], status.Components[i+1:]...)
+			return
+		}
+	}
+}
+
+// ManifestsFromJSON turns the JSON output of a renderer into a multi-document manifest. The output
+// is a Kubernetes object, a list of outputs or an object whose fields are outputs, as with kubecfg
+func ManifestsFromJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]interface{}
+	err = collectObjects(value, "$", &objects)
+	if err != nil {
+		return nil, err
+	}
+	var documents []string
+	for _, object := range objects {
+		document, err := json.Marshal(object)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, string(document))
+	}
+	return []byte(strings.Join(documents, "\n---\n")), nil
+}
+
+func collectObjects(value interface{}, path string, objects *[]map[string]interface{}) error {
+	switch typed := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		for i, item := range typed {
+			err := collectObjects(item, fmt.Sprintf("%s[%d]", path, i), objects)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		if _, ok := typed["kind"]; ok {
+			if _, ok := typed["apiVersion"]; ok {
+				*objects = append(*objects, typed)
+				return nil
+			}
+		}
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			err := collectObjects(typed[key], fmt.Sprintf("%s.%s", path, key), objects)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("rendered value at %s is neither an object nor a list", path)
+	}
+}
@@ -0,0 +1,100 @@
+package componentspec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Graph holds nodes and the nodes each of them depends on
+type Graph struct {
+	nodes        []string
+	dependencies map[string][]string
+}
+
+// CycleError reports nodes depending on themselves through Path, which starts and ends on the same node
+type CycleError struct {
+	Path []string
+}
+
+func (e CycleError) Error() string {
+	return fmt.Sprintf("dependency cycle %s", strings.Join(e.Path, " -> "))
+}
+
+// UnknownDependencyError reports a node depending on a node missing from the graph
+type UnknownDependencyError struct {
+	Node       string
+	Dependency string
+}
+
+func (e UnknownDependencyError) Error() string {
+	return fmt.Sprintf("%s depends on unknown %s", e.Node, e.Dependency)
+}
+
+// NewGraph returns an empty graph
+func NewGraph() *Graph {
+	return &Graph{dependencies: make(map[string][]string)}
+}
+
+// AddNode adds a node, in order, with the nodes it depends on
+func (g *Graph) AddNode(name string, dependsOn []string) {
+	if _, ok := g.dependencies[name]; !ok {
+		g.nodes = append(g.nodes, name)
+	}
+	g.dependencies[name] = dependsOn
+}
+
+// Nodes returns the nodes in the order they were added
+func (g *Graph) Nodes() []string {
+	return g.nodes
+}
+
+func (g *Graph) Dependencies(name string) []string {
+	return g.dependencies[name]
+}
+
+// Validate returns an UnknownDependencyError or a CycleError when the graph is not a DAG
+func (g *Graph) Validate() error {
+	for _, node := range g.nodes {
+		for _, dependency := range g.dependencies[node] {
+			if _, ok := g.dependencies[dependency]; !ok {
+				return UnknownDependencyError{Node: node, Dependency: dependency}
+			}
+		}
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(g.nodes))
+	var path []string
+	var visit func(node string) error
+	visit = func(node string) error {
+		switch state[node] {
+		case visited:
+			return nil
+		case visiting:
+			for i, pathNode := range path {
+				if pathNode == node {
+					return CycleError{Path: append(append([]string{}, path[i:]...), node)}
+				}
+			}
+		}
+		state[node] = visiting
+		path = append(path, node)
+		for _, dependency := range g.dependencies[node] {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[node] = visited
+		return nil
+	}
+	for _, node := range g.nodes {
+		if err := visit(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
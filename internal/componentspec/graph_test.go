@@ -0,0 +1,71 @@
+package componentspec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGraphValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes [][]string
+		err   error
+	}{
+		{
+			name:  "independent nodes",
+			nodes: [][]string{{"api"}, {"web"}},
+		},
+		{
+			name:  "chain",
+			nodes: [][]string{{"web", "api"}, {"api", "db"}, {"db"}},
+		},
+		{
+			name:  "diamond",
+			nodes: [][]string{{"web", "api", "cache"}, {"api", "db"}, {"cache", "db"}, {"db"}},
+		},
+		{
+			name:  "unknown dependency",
+			nodes: [][]string{{"web", "api"}},
+			err:   UnknownDependencyError{Node: "web", Dependency: "api"},
+		},
+		{
+			name:  "self dependency",
+			nodes: [][]string{{"web", "web"}},
+			err:   CycleError{Path: []string{"web", "web"}},
+		},
+		{
+			name:  "cycle",
+			nodes: [][]string{{"web", "api"}, {"api", "db"}, {"db", "api"}},
+			err:   CycleError{Path: []string{"api", "db", "api"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			graph := NewGraph()
+			for _, node := range test.nodes {
+				graph.AddNode(node[0], node[1:])
+			}
+
+			err := graph.Validate()
+
+			if !reflect.DeepEqual(err, test.err) {
+				t.Errorf("expected error %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestGraphKeepsNodeOrder(t *testing.T) {
+	graph := NewGraph()
+	graph.AddNode("web", []string{"api"})
+	graph.AddNode("api", nil)
+	graph.AddNode("web", []string{"api", "db"})
+	graph.AddNode("db", nil)
+
+	if nodes := graph.Nodes(); !reflect.DeepEqual(nodes, []string{"web", "api", "db"}) {
+		t.Errorf("expected the nodes in the order they were first added, got %v", nodes)
+	}
+	if dependencies := graph.Dependencies("web"); !reflect.DeepEqual(dependencies, []string{"api", "db"}) {
+		t.Errorf("expected the dependencies of the last AddNode, got %v", dependencies)
+	}
+}
@@ -0,0 +1,42 @@
+// Package componentspec holds the checks on component specs shared by the API webhooks and the
+// controller: the supported providers, the parsing of source urls and the dependency graph.
+// It must not depend on the controller packages, which the API types can not import.
+package componentspec
+
+import (
+	"net/url"
+	"strings"
+)
+
+const GithubProvider = "GITHUB"
+
+// GitlabProvider and BitbucketProvider send push webhooks, they are not supported as component sources yet
+const (
+	GitlabProvider    = "GITLAB"
+	BitbucketProvider = "BITBUCKET"
+)
+
+// Providers lists the supported providers
+var Providers = []string{GithubProvider}
+
+func IsSupported(provider string) bool {
+	for _, supported := range Providers {
+		if supported == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// InferProvider guesses the provider from the host of a repository url, returning an empty string when unknown
+func InferProvider(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if host == githubHost || strings.HasSuffix(host, "."+githubHost) || strings.HasPrefix(host, "github.") {
+		return GithubProvider
+	}
+	return ""
+}
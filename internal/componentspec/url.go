@@ -0,0 +1,142 @@
+package componentspec
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	githubHost       = "github.com"
+	githubApiUrl     = "https://api.github.com"
+	githubEnterprise = "/api/v3"
+	githubReposPath  = "/repos/"
+	githubContents   = "/contents"
+	// repositoryPathSeparator splits the repository from the path inside it, as in kustomize remote urls
+	repositoryPathSeparator = "//"
+	// gitlabPathSeparator and bitbucketPathSeparator start the path of the web interface urls
+	gitlabPathSeparator    = "/-/"
+	bitbucketPathSeparator = "/src/"
+)
+
+// Location is where a component source lives
+type Location struct {
+	// Host is the host of the provider web interface, as github.com
+	Host string
+	// ApiUrl is the root of the provider API, as https://api.github.com or https://github.example.com/api/v3
+	ApiUrl string
+	Owner  string
+	Name   string
+	// Path is the directory of the source, relative to the repository root
+	Path string
+	// Ref is the ref pinned in the url, empty when it pins none
+	Ref string
+}
+
+// FullName returns the owner/name of the repository
+func (l Location) FullName() string {
+	return fmt.Sprintf("%s/%s", l.Owner, l.Name)
+}
+
+// ParseURL parses the chart url of a component of a supported provider
+func ParseURL(provider string, rawUrl string) (Location, error) {
+	if !IsSupported(provider) {
+		return Location{}, fmt.Errorf("provider %s not supported", provider)
+	}
+	return ParseRepositoryURL(provider, rawUrl)
+}
+
+// ParseRepositoryURL parses a repository url of any provider sending push webhooks, the API url
+// only being known for the supported ones
+func ParseRepositoryURL(provider string, rawUrl string) (Location, error) {
+	switch provider {
+	case GithubProvider:
+		return parseGithubUrl(rawUrl)
+	case GitlabProvider:
+		return parseRepositoryUrl(rawUrl, gitlabPathSeparator, 0)
+	case BitbucketProvider:
+		return parseRepositoryUrl(rawUrl, bitbucketPathSeparator, 2)
+	default:
+		return Location{}, fmt.Errorf("unknown provider %s", provider)
+	}
+}
+
+// parseRepositoryUrl parses urls such as https://gitlab.com/group/subgroup/project//path?ref=main, the
+// repository ending before "//" or separator, and after maxSegments segments when it is not zero
+func parseRepositoryUrl(rawUrl string, separator string, maxSegments int) (Location, error) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return Location{}, fmt.Errorf("invalid repository url %s: %w", rawUrl, err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return Location{}, fmt.Errorf("invalid repository url %s: scheme and host are required", rawUrl)
+	}
+	location := Location{Host: strings.ToLower(parsed.Host), Ref: parsed.Query().Get("ref")}
+	repoPath := parsed.Path
+	if index := strings.Index(repoPath, repositoryPathSeparator); index > 0 {
+		location.Path = strings.Trim(repoPath[index+len(repositoryPathSeparator):], "/")
+		repoPath = repoPath[:index]
+	}
+	// the ref and path of web interface urls are not parsed, the repository ending before them
+	if index := strings.Index(repoPath, separator); index > 0 {
+		repoPath = repoPath[:index]
+	}
+	segments := strings.Split(strings.Trim(repoPath, "/"), "/")
+	if maxSegments > 0 && len(segments) > maxSegments {
+		segments = segments[:maxSegments]
+	}
+	if len(segments) < 2 || segments[0] == "" {
+		return Location{}, fmt.Errorf("invalid repository url %s: owner and repository are required", rawUrl)
+	}
+	location.Owner = strings.Join(segments[:len(segments)-1], "/")
+	location.Name = strings.TrimSuffix(segments[len(segments)-1], ".git")
+	return location, nil
+}
+
+// parseGithubUrl accepts repository urls such as https://github.example.com/org/repo//path?ref=main,
+// where the path may also follow the repository without the double slash, as well as contents
+// API urls such as https://api.github.com/repos/org/repo/contents/path
+func parseGithubUrl(rawUrl string) (Location, error) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return Location{}, fmt.Errorf("invalid github url %s: %w", rawUrl, err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return Location{}, fmt.Errorf("invalid github url %s: scheme and host are required", rawUrl)
+	}
+	location := Location{Host: strings.ToLower(parsed.Host), Ref: parsed.Query().Get("ref")}
+	if location.Host == "api."+githubHost || location.Host == "www."+githubHost {
+		location.Host = githubHost
+	}
+	host := fmt.Sprintf("%s://%s", parsed.Scheme, parsed.Host)
+
+	var repoPath string
+	reposIndex := strings.Index(parsed.Path, githubReposPath)
+	if reposIndex >= 0 && strings.Contains(parsed.Path, githubContents) {
+		location.ApiUrl = host + parsed.Path[:reposIndex]
+		repoPath = strings.Replace(parsed.Path[reposIndex+len(githubReposPath):], githubContents, repositoryPathSeparator, 1)
+	} else {
+		location.ApiUrl = host + githubEnterprise
+		if parsed.Host == githubHost || parsed.Host == "www."+githubHost {
+			location.ApiUrl = githubApiUrl
+		}
+		repoPath = strings.TrimPrefix(parsed.Path, "/")
+	}
+
+	var path string
+	if index := strings.Index(repoPath, repositoryPathSeparator); index >= 0 {
+		path = repoPath[index+len(repositoryPathSeparator):]
+		repoPath = repoPath[:index]
+	}
+	segments := strings.SplitN(strings.Trim(repoPath, "/"), "/", 3)
+	if len(segments) < 2 || segments[0] == "" || segments[1] == "" {
+		return Location{}, fmt.Errorf("invalid github url %s: owner and repository are required", rawUrl)
+	}
+	if len(segments) == 3 {
+		path = strings.Join([]string{segments[2], path}, "/")
+	}
+	location.Owner = segments[0]
+	location.Name = strings.TrimSuffix(segments[1], ".git")
+	location.Path = strings.Trim(path, "/")
+	return location, nil
+}
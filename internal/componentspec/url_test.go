@@ -0,0 +1,127 @@
+package componentspec
+
+import (
+	"testing"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		url      string
+		expected Location
+		err      bool
+	}{
+		{
+			name:     "github repository",
+			provider: GithubProvider,
+			url:      "https://github.com/org/repo.git",
+			expected: Location{Host: "github.com", ApiUrl: "https://api.github.com", Owner: "org", Name: "repo"},
+		},
+		{
+			name:     "github path after the repository",
+			provider: GithubProvider,
+			url:      "https://github.com/org/repo/deploy/app",
+			expected: Location{Host: "github.com", ApiUrl: "https://api.github.com", Owner: "org", Name: "repo", Path: "deploy/app"},
+		},
+		{
+			name:     "github double slash path and ref",
+			provider: GithubProvider,
+			url:      "https://github.com/org/repo//deploy/app/?ref=v1.0.0",
+			expected: Location{Host: "github.com", ApiUrl: "https://api.github.com", Owner: "org", Name: "repo", Path: "deploy/app", Ref: "v1.0.0"},
+		},
+		{
+			name:     "github enterprise",
+			provider: GithubProvider,
+			url:      "https://GitHub.Example.com/org/repo//deploy?ref=main",
+			expected: Location{Host: "github.example.com", ApiUrl: "https://GitHub.Example.com/api/v3", Owner: "org", Name: "repo", Path: "deploy", Ref: "main"},
+		},
+		{
+			name:     "contents API",
+			provider: GithubProvider,
+			url:      "https://api.github.com/repos/org/repo/contents/deploy/app?ref=main",
+			expected: Location{Host: "github.com", ApiUrl: "https://api.github.com", Owner: "org", Name: "repo", Path: "deploy/app", Ref: "main"},
+		},
+		{
+			name:     "github enterprise contents API",
+			provider: GithubProvider,
+			url:      "https://github.example.com/api/v3/repos/org/repo/contents/deploy",
+			expected: Location{Host: "github.example.com", ApiUrl: "https://github.example.com/api/v3", Owner: "org", Name: "repo", Path: "deploy"},
+		},
+		{
+			name:     "missing repository",
+			provider: GithubProvider,
+			url:      "https://github.com/org",
+			err:      true,
+		},
+		{
+			name:     "missing scheme",
+			provider: GithubProvider,
+			url:      "github.com/org/repo",
+			err:      true,
+		},
+		{
+			name:     "unsupported provider",
+			provider: GitlabProvider,
+			url:      "https://gitlab.com/group/project",
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			location, err := ParseURL(test.provider, test.url)
+
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", location)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if location != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, location)
+			}
+		})
+	}
+}
+
+func TestParseRepositoryURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		url      string
+		expected Location
+	}{
+		{
+			name:     "gitlab nested groups",
+			provider: GitlabProvider,
+			url:      "https://gitlab.com/group/subgroup/project//deploy?ref=main",
+			expected: Location{Host: "gitlab.com", Owner: "group/subgroup", Name: "project", Path: "deploy", Ref: "main"},
+		},
+		{
+			name:     "gitlab web interface",
+			provider: GitlabProvider,
+			url:      "https://gitlab.com/group/project/-/tree/main/deploy",
+			expected: Location{Host: "gitlab.com", Owner: "group", Name: "project"},
+		},
+		{
+			name:     "bitbucket web interface",
+			provider: BitbucketProvider,
+			url:      "https://bitbucket.org/team/repo/src/main/deploy",
+			expected: Location{Host: "bitbucket.org", Owner: "team", Name: "repo"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			location, err := ParseRepositoryURL(test.provider, test.url)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if location != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, location)
+			}
+		})
+	}
+}
@@ -19,22 +19,52 @@ package controllers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/prometheus/common/log"
 	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
 	"github.com/thalleslmF/go-operator/internal/common"
+	"github.com/thalleslmF/go-operator/internal/componentspec"
+	"github.com/thalleslmF/go-operator/internal/cue"
+	"github.com/thalleslmF/go-operator/internal/jsonnet"
 	"github.com/thalleslmF/go-operator/internal/k8s"
 	"github.com/thalleslmF/go-operator/internal/kustomize"
+	"github.com/thalleslmF/go-operator/internal/repository"
+	"github.com/thalleslmF/go-operator/internal/sourcecache"
+	"github.com/thalleslmF/go-operator/internal/substitute"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	_ "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/dynamic/dynamiclister"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
+	"path/filepath"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	syncIntervalJitterFactor = 0.1
+	// operationPollInterval is how often a component sync waiting for resources or hooks is resumed
+	operationPollInterval = 5 * time.Second
 )
 
 // CharlesDeploymentController reconciles a CharlesDeployment object
@@ -42,17 +72,26 @@ type CharlesDeploymentController struct {
 	client.Client
 	Scheme                 *runtime.Scheme
 	Informers              map[string]cache.SharedIndexInformer
-	Queue                  workqueue.RateLimitingInterface
 	DynamicClient          dynamic.Interface
 	DynamicService         k8s.DynamicService
 	DynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
 	ChildInformerHandler   cache.ResourceEventHandler
 	CharlesLister          dynamiclister.Lister
+	SourceCache            *sourcecache.Cache
+	RepositoryOptions      repository.Options
+	KustomizeOptions       kustomize.Options
+	// PushEvents are the CharlesDeployments to reconcile after a push to one of their sources
+	PushEvents <-chan event.GenericEvent
+	// syncCancels holds the cancel func of the in-flight sync of each CharlesDeployment
+	syncCancels sync.Map
 }
 
-//+kubebuilder:rbac:groups=io.charlescd.my.domain,resources=charlesdeployments,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=io.charlescd.my.domain,resources=charlesdeployments/status,verbs=get;update;patch
-//+kubebuilder:rbac:groups=io.charlescd.my.domain,resources=charlesdeployments/finalizers,verbs=update
+//+kubebuilder:rbac:groups=charlescd.io,resources=charlesdeployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=charlescd.io,resources=charlesdeployments/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=charlescd.io,resources=charlesdeployments/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -64,95 +103,635 @@ type CharlesDeploymentController struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.10.0/pkg/reconcile
 func (cd *CharlesDeploymentController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	err := cd.Sync(req.NamespacedName)
+	result, err := cd.Sync(ctx, req.NamespacedName)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return result, nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. CharlesDeployments are only reconciled again
+// when their spec or annotations change, the status written by a reconcile not triggering another one.
 func (cd *CharlesDeploymentController) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&iocharlescdv1.CharlesDeployment{}).
-		Complete(cd)
+	managedBy := ctrl.NewControllerManagedBy(mgr).
+		For(&iocharlescdv1.CharlesDeployment{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		Watches(&source.Kind{Type: &iocharlescdv1.CharlesDeployment{}}, handler.Funcs{DeleteFunc: cd.cancelSync})
+	if cd.PushEvents != nil {
+		managedBy = managedBy.Watches(&source.Channel{Source: cd.PushEvents}, &handler.EnqueueRequestForObject{})
+	}
+	return managedBy.Complete(cd)
 }
 
-func (cd *CharlesDeploymentController) Sync(key client.ObjectKey) error {
+// cancelSync aborts the in-flight sync, and its downloads, of a deleted CharlesDeployment
+func (cd *CharlesDeploymentController) cancelSync(e event.DeleteEvent, _ workqueue.RateLimitingInterface) {
+	cancel, ok := cd.syncCancels.Load(client.ObjectKeyFromObject(e.Object))
+	if ok {
+		log.Info("Canceling sync of deleted charles deployment ", e.Object.GetName())
+		cancel.(context.CancelFunc)()
+	}
+}
+
+func (cd *CharlesDeploymentController) Sync(ctx context.Context, key client.ObjectKey) (ctrl.Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cd.syncCancels.Store(key, cancel)
+	defer cd.syncCancels.Delete(key)
 	charlesDeployment := &iocharlescdv1.CharlesDeployment{}
 
-	err := cd.Get(context.TODO(), key, charlesDeployment)
+	err := cd.Get(ctx, key, charlesDeployment)
 	log.Info("Start reconcile for ", charlesDeployment)
 	if err != nil {
-		return err
+		return ctrl.Result{}, err
+	}
+	observed := charlesDeployment.Status.DeepCopy()
+	if charlesDeployment.IsSuspended() {
+		log.Info("Reconciliation of ", charlesDeployment.Name, " is suspended")
+		return ctrl.Result{}, cd.setSuspended(ctx, charlesDeployment)
+	}
+	apimeta.SetStatusCondition(&charlesDeployment.Status.Conditions, metav1.Condition{
+		Type:               iocharlescdv1.SuspendedCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ReconciliationEnabled",
+		ObservedGeneration: charlesDeployment.Generation,
+	})
+	requestedAt, force := charlesDeployment.SyncRequest()
+	if force {
+		log.Info(fmt.Sprintf("Sync of %s requested at %s", charlesDeployment.Name, requestedAt))
+		charlesDeployment.Status.LastHandledSyncRequest = requestedAt
+	}
+	pending := false
+	if charlesDeployment.Spec.DryRun {
+		err = cd.DryRun(ctx, charlesDeployment, *observed)
+	} else {
+		pending, err = cd.SyncComponents(ctx, charlesDeployment, force)
 	}
-	err = cd.SyncComponents(*charlesDeployment)
 	if err != nil {
-		return err
+		return handleSyncError(err, *charlesDeployment)
+	}
+	if pending {
+		return ctrl.Result{RequeueAfter: operationPollInterval}, nil
+	}
+	return requeueAfterSyncInterval(*charlesDeployment), nil
+}
+
+// setSuspended records the Suspended condition, only writing the status when the condition changes
+func (cd *CharlesDeploymentController) setSuspended(ctx context.Context, charlesDeployment *iocharlescdv1.CharlesDeployment) error {
+	reason := "SpecSuspended"
+	message := "spec.suspend is set"
+	if !charlesDeployment.Spec.Suspend {
+		reason = "ReconcileAnnotationDisabled"
+		message = fmt.Sprintf("%s is %s", iocharlescdv1.ReconcileAnnotation, iocharlescdv1.ReconcileDisabled)
+	}
+	condition := apimeta.FindStatusCondition(charlesDeployment.Status.Conditions, iocharlescdv1.SuspendedCondition)
+	if condition != nil && condition.Status == metav1.ConditionTrue && condition.Reason == reason {
+		return nil
+	}
+	apimeta.SetStatusCondition(&charlesDeployment.Status.Conditions, metav1.Condition{
+		Type:               iocharlescdv1.SuspendedCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: charlesDeployment.Generation,
+	})
+	return cd.Status().Update(ctx, charlesDeployment)
+}
+
+// handleSyncError waits out provider rate limits instead of retrying with backoff, and
+// does not retry missing sources or rejected credentials until the next poll or spec change
+func handleSyncError(err error, charlesDeployment iocharlescdv1.CharlesDeployment) (ctrl.Result, error) {
+	var rateLimited repository.RateLimitedError
+	if errors.As(err, &rateLimited) {
+		log.Info(fmt.Sprintf("Provider rate limited %s, requeueing after %s", charlesDeployment.Name, rateLimited.RetryAfter))
+		return ctrl.Result{RequeueAfter: rateLimited.RetryAfter}, nil
 	}
-	return nil
+	var notFound repository.NotFoundError
+	var unauthorized repository.UnauthorizedError
+	if errors.As(err, &notFound) || errors.As(err, &unauthorized) {
+		log.Error("Error fetching component source of ", charlesDeployment.Name, ": ", err)
+		return requeueAfterSyncInterval(charlesDeployment), nil
+	}
+	return ctrl.Result{}, err
 }
 
-func (cd *CharlesDeploymentController) SyncComponents(charlesDeployment iocharlescdv1.CharlesDeployment) error {
+// requeueAfterSyncInterval schedules the next poll of the component sources, jittered
+// so deployments sharing the same interval do not hit the providers at the same time.
+func requeueAfterSyncInterval(charlesDeployment iocharlescdv1.CharlesDeployment) ctrl.Result {
+	if charlesDeployment.Spec.SyncInterval == nil || charlesDeployment.Spec.SyncInterval.Duration <= 0 {
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: wait.Jitter(charlesDeployment.Spec.SyncInterval.Duration, syncIntervalJitterFactor)}
+}
+
+// componentResult is the status and error of a component synced by SyncComponents
+type componentResult struct {
+	component iocharlescdv1.Component
+	status    iocharlescdv1.ComponentStatus
+	err       error
+}
+
+// SyncComponents applies the components in dependency order, running the components whose dependencies
+// are all ready in parallel. Components left behind by a failed or still syncing dependency are reported
+// blocked and the status of every component is written once all of them are done. It tells whether
+// a component sync is still in progress, to be resumed by the next reconcile.
+func (cd *CharlesDeploymentController) SyncComponents(ctx context.Context, charlesDeployment *iocharlescdv1.CharlesDeployment, force bool) (bool, error) {
+	graph := componentspec.NewGraph()
+	components := make(map[string]iocharlescdv1.Component, len(charlesDeployment.Spec.Components))
 	for _, component := range charlesDeployment.Spec.Components {
-		err := cd.createCharlesComponent(component, charlesDeployment)
-		if err != nil {
-			log.Info("Error creating charles component", err)
-			return err
+		graph.AddNode(component.Name, component.DependsOn)
+		components[component.Name] = component
+	}
+	err := graph.Validate()
+	if err != nil {
+		return false, err
+	}
+	results := make(chan componentResult)
+	finished := make(map[string]componentResult, len(components))
+	started := make(map[string]bool, len(components))
+	running := 0
+	for {
+		for _, name := range graph.Nodes() {
+			if started[name] || len(blockingDependencies(graph, name, finished)) > 0 {
+				continue
+			}
+			started[name] = true
+			running++
+			go func(component iocharlescdv1.Component) {
+				status, err := cd.syncComponent(ctx, component, charlesDeployment, force)
+				results <- componentResult{component: component, status: status, err: err}
+			}(components[name])
+		}
+		if running == 0 {
+			break
 		}
+		result := <-results
+		running--
+		if result.err != nil {
+			log.Error(fmt.Sprintf("Error syncing charles component %s: %s", result.component.Name, result.err))
+		}
+		finished[result.component.Name] = result
+	}
+	var syncErr error
+	pending := false
+	for _, name := range graph.Nodes() {
+		previous := iocharlescdv1.ComponentStatus{Name: name}
+		if componentStatus := common.FindComponentStatus(charlesDeployment.Status, name); componentStatus != nil {
+			previous = *componentStatus
+		}
+		result, ok := finished[name]
+		switch {
+		case !ok:
+			blockedBy := blockingDependencies(graph, name, finished)
+			previous.Ready = false
+			previous.BlockedBy = blockedBy
+			previous.Message = fmt.Sprintf("waiting for %s to be ready", strings.Join(blockedBy, ", "))
+			common.SetComponentStatus(&charlesDeployment.Status, previous)
+		case result.err != nil:
+			previous.Ready = false
+			previous.BlockedBy = nil
+			previous.Message = result.err.Error()
+			previous.Operation = nil
+			if result.status.Hooks != nil {
+				previous.Hooks = result.status.Hooks
+			}
+			if result.status.AppliedKinds != nil {
+				previous.AppliedKinds = result.status.AppliedKinds
+			}
+			common.SetComponentStatus(&charlesDeployment.Status, previous)
+			if syncErr == nil {
+				syncErr = result.err
+			}
+		default:
+			pending = pending || !result.status.Ready
+			common.SetComponentStatus(&charlesDeployment.Status, result.status)
+		}
+	}
+	err = cd.pruneRemovedComponents(ctx, charlesDeployment)
+	if err != nil && syncErr == nil {
+		syncErr = err
+	}
+	charlesDeployment.Status.DryRun = nil
+	err = cd.Status().Update(ctx, charlesDeployment)
+	if err != nil && syncErr == nil {
+		return pending, err
 	}
-	return nil
+	return pending, syncErr
 }
 
-func (cd *CharlesDeploymentController) Start() error {
-	for cd.processNextWorkItem() {
+// blockingDependencies returns the dependencies of name that are not ready yet
+func blockingDependencies(graph *componentspec.Graph, name string, finished map[string]componentResult) []string {
+	var blocking []string
+	for _, dependency := range graph.Dependencies(name) {
+		if result, ok := finished[dependency]; !ok || result.err != nil || !result.status.Ready {
+			blocking = append(blocking, dependency)
+		}
 	}
-	return errors.New("error processing  item")
+	return blocking
 }
 
-func (cd *CharlesDeploymentController) processNextWorkItem() bool {
-	key, stop := cd.Queue.Get()
-	if stop {
-		return false
+// syncComponent resolves the component source to a commit and only renders and applies it again when that
+// commit or the component spec changed since the last sync, or when forced, resuming the sync in progress.
+// A Manual component stays at its applied commit until the resolved one is promoted.
+// The returned status is not Ready while the sync waits for resources or hooks to be healthy.
+func (cd *CharlesDeploymentController) syncComponent(ctx context.Context, component iocharlescdv1.Component, charlesDeployment *iocharlescdv1.CharlesDeployment, force bool) (iocharlescdv1.ComponentStatus, error) {
+	repo, resolved, variables, err := cd.resolveComponent(ctx, component, charlesDeployment.Namespace)
+	if err != nil {
+		return iocharlescdv1.ComponentStatus{}, err
 	}
-	defer cd.Queue.Done(key)
-	namespace, name, err := cache.SplitMetaNamespaceKey(key.(string))
+	specHash, err := common.HashComponent(component, variables)
 	if err != nil {
-		log.Error("Error getting object key", err)
-		return false
+		return iocharlescdv1.ComponentStatus{}, err
+	}
+	previous := iocharlescdv1.ComponentStatus{Name: component.Name}
+	if componentStatus := common.FindComponentStatus(charlesDeployment.Status, component.Name); componentStatus != nil {
+		previous = *componentStatus
+	}
+	revision, pendingRevision := charlesDeployment.RolloutRevision(component, previous.Revision, resolved)
+	if pendingRevision != "" {
+		log.Info(fmt.Sprintf("Component %s holds revision %s until it is promoted", component.Name, pendingRevision))
+	}
+	operation := iocharlescdv1.OperationStatus{Revision: revision, SpecHash: specHash}
+	var hooks []iocharlescdv1.HookStatus
+	switch {
+	case previous.Operation != nil && previous.Operation.Revision == revision && previous.Operation.SpecHash == specHash:
+		operation = *previous.Operation
+		hooks = previous.Hooks
+	case previous.Operation == nil && !force && previous.Revision == revision && previous.SpecHash == specHash:
+		log.Info(fmt.Sprintf("Component %s already synced at revision %s", component.Name, revision))
+		previous.Ready = true
+		previous.BlockedBy = nil
+		previous.Message = ""
+		previous.PendingRevision = pendingRevision
+		return previous, nil
 	}
-	err = cd.Sync(client.ObjectKey{Name: name, Namespace: namespace})
+	status, err := cd.createCharlesComponent(ctx, repo, revision, component, variables, *charlesDeployment, operation)
+	status.Hooks = append(hooks, status.Hooks...)
 	if err != nil {
-		return true
+		return status, err
 	}
-	cd.Queue.Forget(key)
-	return true
+	status.Name = component.Name
+	status.PendingRevision = pendingRevision
+	if status.Operation != nil {
+		status.Revision = previous.Revision
+		status.SpecHash = previous.SpecHash
+		status.LastSyncTime = previous.LastSyncTime
+		status.Message = fmt.Sprintf("syncing revision %s: %s", revision, status.Message)
+		return status, nil
+	}
+	status.Revision = revision
+	status.SpecHash = specHash
+	status.LastSyncTime = metav1.Now()
+	status.Ready = true
+	return status, nil
 }
 
-func (cd *CharlesDeploymentController) createCharlesComponent(component iocharlescdv1.Component, charlesDeployment iocharlescdv1.CharlesDeployment) error {
-	var unstructured unstructured.Unstructured
-	kustomizeWrapper := kustomize.New()
-	response, err := kustomizeWrapper.RenderManifests(component.Chart)
+// resolveComponent returns the repository of the component, the commit its ref points to and its substitution variables
+func (cd *CharlesDeploymentController) resolveComponent(ctx context.Context, component iocharlescdv1.Component, namespace string) (repository.Repository, string, map[string]string, error) {
+	credentials, err := cd.getCredentials(ctx, component, namespace)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	repo, err := repository.NewRepository(component.Provider, component.Chart, credentials, cd.RepositoryOptions)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	revision, err := repo.ResolveRevision(ctx, component.Ref)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	variables, err := cd.getVariables(ctx, component, namespace)
 	if err != nil {
-		return err
+		return nil, "", nil, err
 	}
-	resources := response.Resources()
+	return repo, revision, variables, nil
+}
 
-	for _, resource := range resources {
-		resourceBytes, err := json.Marshal(resource)
+// getCredentials reads the provider credentials and CA bundle from the Secret and ConfigMap referenced by the component, if any
+func (cd *CharlesDeploymentController) getCredentials(ctx context.Context, component iocharlescdv1.Component, namespace string) (repository.Credentials, error) {
+	credentials := repository.Credentials{}
+	if component.SecretRef != "" {
+		secret := corev1.Secret{}
+		err := cd.Get(ctx, client.ObjectKey{Namespace: namespace, Name: component.SecretRef}, &secret)
 		if err != nil {
-			return err
+			return repository.Credentials{}, err
+		}
+		credentials, err = repository.CredentialsFromSecret(secret)
+		if err != nil {
+			return repository.Credentials{}, err
 		}
-		err = json.Unmarshal(resourceBytes, &unstructured)
+	}
+	if component.CAConfigMapRef != "" {
+		configMap := corev1.ConfigMap{}
+		err := cd.Get(ctx, client.ObjectKey{Namespace: namespace, Name: component.CAConfigMapRef}, &configMap)
+		if err != nil {
+			return repository.Credentials{}, err
+		}
+		credentials.CACert = []byte(configMap.Data[repository.CACertKey])
+	}
+	return credentials, nil
+}
+
+// kustomizeOptions merges the build options of the component over the operator ones,
+// the allowed functions and the helm command can only be set on the operator
+func (cd *CharlesDeploymentController) kustomizeOptions(component iocharlescdv1.Component) (kustomize.Options, error) {
+	options := cd.KustomizeOptions
+	if component.Kustomize != nil {
+		options.EnableHelm = component.Kustomize.EnableHelm
+		options.EnableAlphaPlugins = component.Kustomize.EnableAlphaPlugins
+		options.EnableExec = component.Kustomize.EnableExec
+		if component.Kustomize.Reorder != "" {
+			options.Reorder = component.Kustomize.Reorder
+		}
+		if component.Kustomize.LoadRestrictor != "" {
+			loadRestrictions, err := kustomize.ParseLoadRestrictions(component.Kustomize.LoadRestrictor)
+			if err != nil {
+				return kustomize.Options{}, err
+			}
+			if loadRestrictions == types.LoadRestrictionsNone && cd.KustomizeOptions.LoadRestrictions != types.LoadRestrictionsNone {
+				return kustomize.Options{}, fmt.Errorf("component %s can not lift the load restrictions of the operator", component.Name)
+			}
+			options.LoadRestrictions = loadRestrictions
+		}
+	}
+	err := options.Validate()
+	if err != nil {
+		return kustomize.Options{}, fmt.Errorf("invalid kustomize options of component %s: %w", component.Name, err)
+	}
+	return options, nil
+}
+
+// getVariables merges the substitution variables of the ConfigMaps and Secrets referenced by the component with its inline ones
+func (cd *CharlesDeploymentController) getVariables(ctx context.Context, component iocharlescdv1.Component, namespace string) (map[string]string, error) {
+	if !common.SubstitutionEnabled(component) {
+		return nil, nil
+	}
+	variables := make(map[string]string)
+	for _, reference := range component.SubstituteFrom {
+		key := client.ObjectKey{Namespace: namespace, Name: reference.Name}
+		var err error
+		switch reference.Kind {
+		case "ConfigMap":
+			configMap := corev1.ConfigMap{}
+			err = cd.Get(ctx, key, &configMap)
+			for name, value := range configMap.Data {
+				variables[name] = value
+			}
+		case "Secret":
+			secret := corev1.Secret{}
+			err = cd.Get(ctx, key, &secret)
+			for name, value := range secret.Data {
+				variables[name] = string(value)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported substituteFrom kind %s of component %s", reference.Kind, component.Name)
+		}
+		if apierrors.IsNotFound(err) && reference.Optional {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range component.Substitute {
+		variables[name] = value
+	}
+	return variables, nil
+}
+
+// renderChart evaluates the jsonnet or CUE chart of the component into fsys, returning where its manifests are,
+// kustomize charts are returned as is
+func renderChart(fsys filesys.FileSystem, chart string, component iocharlescdv1.Component) (string, error) {
+	var manifests []byte
+	var err error
+	switch {
+	case component.Jsonnet != nil && component.Cue != nil:
+		return "", fmt.Errorf("component %s can not be rendered with both jsonnet and cue", component.Name)
+	case component.Jsonnet != nil:
+		manifests, err = jsonnet.Render(fsys, chart, jsonnet.Options{
+			Entrypoint: component.Jsonnet.Entrypoint,
+			ExtVars:    component.Jsonnet.ExtVars,
+			TLAs:       component.Jsonnet.TLAs,
+			JPaths:     component.Jsonnet.JPaths,
+		})
+	case component.Cue != nil:
+		manifests, err = cue.Render(fsys, chart, cue.Options{
+			Package:    component.Cue.Package,
+			Expression: component.Cue.Expression,
+			Tags:       component.Cue.Tags,
+		})
+	default:
+		return chart, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return kustomize.WriteManifests(fsys, manifests)
+}
+
+func directoryOptions(component iocharlescdv1.Component) kustomize.DirectoryOptions {
+	if component.Directory == nil {
+		return kustomize.DirectoryOptions{}
+	}
+	return kustomize.DirectoryOptions{
+		Recursive: component.Directory.Recursive,
+		Include:   component.Directory.Include,
+		Exclude:   component.Directory.Exclude,
+	}
+}
+
+// kustomizeOverrides converts the inline patches and transformers of the component to kustomize types
+func kustomizeOverrides(component iocharlescdv1.Component) kustomize.Overrides {
+	overrides := kustomize.Overrides{
+		CommonLabels:      component.CommonLabels,
+		CommonAnnotations: component.CommonAnnotations,
+		NamePrefix:        component.NamePrefix,
+		NameSuffix:        component.NameSuffix,
+	}
+	for _, patch := range component.Patches {
+		kustomizePatch := types.Patch{Patch: patch.Patch}
+		if patch.Target != nil {
+			kustomizePatch.Target = &types.Selector{
+				ResId: resid.ResId{
+					Gvk:       resid.Gvk{Group: patch.Target.Group, Version: patch.Target.Version, Kind: patch.Target.Kind},
+					Name:      patch.Target.Name,
+					Namespace: patch.Target.Namespace,
+				},
+				LabelSelector:      patch.Target.LabelSelector,
+				AnnotationSelector: patch.Target.AnnotationSelector,
+			}
+		}
+		overrides.Patches = append(overrides.Patches, kustomizePatch)
+	}
+	for _, replica := range component.Replicas {
+		overrides.Replicas = append(overrides.Replicas, types.Replica{Name: replica.Name, Count: replica.Count})
+	}
+	for _, image := range component.Images {
+		overrides.Images = append(overrides.Images, types.Image{Name: image.Name, NewName: image.NewName, NewTag: image.NewTag, Digest: image.Digest})
+	}
+	return overrides
+}
+
+// createCharlesComponent renders the component and moves its sync forward from the operation, pruning the
+// objects it no longer renders once the sync succeeded. The returned status holds the hooks that finished and
+// the kinds applied for the component, and the operation to resume with what it waits for while not done.
+func (cd *CharlesDeploymentController) createCharlesComponent(ctx context.Context, repo repository.Repository, revision string, component iocharlescdv1.Component, variables map[string]string, charlesDeployment iocharlescdv1.CharlesDeployment, operation iocharlescdv1.OperationStatus) (iocharlescdv1.ComponentStatus, error) {
+	objects, err := cd.renderComponent(ctx, repo, revision, component, variables, charlesDeployment)
+	if err != nil {
+		return iocharlescdv1.ComponentStatus{}, err
+	}
+	var recorded []iocharlescdv1.AppliedKind
+	if componentStatus := common.FindComponentStatus(charlesDeployment.Status, component.Name); componentStatus != nil {
+		recorded = componentStatus.AppliedKinds
+	}
+	result, err := cd.DynamicService.Sync(ctx, objects, k8s.SyncState{
+		Stage:     int(operation.Stage),
+		Applied:   operation.Applied,
+		StartedAt: operation.StartedAt.Time,
+		Failure:   operation.Failure,
+	})
+	status := iocharlescdv1.ComponentStatus{Hooks: hookStatuses(result.Hooks), AppliedKinds: appliedKinds(recorded, objects)}
+	if err != nil {
+		return status, err
+	}
+	if !result.Done {
+		status.Operation = &iocharlescdv1.OperationStatus{
+			Revision:  operation.Revision,
+			SpecHash:  operation.SpecHash,
+			Stage:     int32(result.State.Stage),
+			Applied:   result.State.Applied,
+			StartedAt: metav1.NewTime(result.State.StartedAt),
+			Failure:   result.State.Failure,
+		}
+		status.Message = result.Message
+		return status, nil
+	}
+	orphans, err := cd.componentOrphans(ctx, charlesDeployment, component.Name, objects)
+	if err != nil {
+		return status, err
+	}
+	err = cd.DynamicService.Prune(ctx, orphans)
+	if err != nil {
+		return status, err
+	}
+	status.AppliedKinds = appliedKinds(nil, objects)
+	return status, nil
+}
+
+// RenderComponent resolves and renders the named component of the deployment the way a sync does,
+// without applying it, returning the objects and the commit they were rendered from
+func (cd *CharlesDeploymentController) RenderComponent(ctx context.Context, charlesDeployment iocharlescdv1.CharlesDeployment, name string) ([]unstructured.Unstructured, string, error) {
+	for _, component := range charlesDeployment.Spec.Components {
+		if component.Name != name {
+			continue
+		}
+		repo, revision, variables, err := cd.resolveComponent(ctx, component, charlesDeployment.Namespace)
+		if err != nil {
+			return nil, "", err
+		}
+		objects, err := cd.renderComponent(ctx, repo, revision, component, variables, charlesDeployment)
+		return objects, revision, err
+	}
+	return nil, "", fmt.Errorf("%s has no component %s", charlesDeployment.Name, name)
+}
+
+// renderComponent renders the component source at revision into the objects to apply, owned by the deployment
+func (cd *CharlesDeploymentController) renderComponent(ctx context.Context, repo repository.Repository, revision string, component iocharlescdv1.Component, variables map[string]string, charlesDeployment iocharlescdv1.CharlesDeployment) ([]unstructured.Unstructured, error) {
+	// the whole tree is cached, components on other paths of the repository share the entry
+	key := sourcecache.Key(component.Provider, repo.FullName(), revision)
+	dir, release, err := cd.SourceCache.Get(key, func(dir string) error {
+		contents, err := repo.GetContent(ctx, revision)
 		if err != nil {
 			return err
 		}
-		common.CreateOwnerReference(&unstructured, charlesDeployment)
-		err = cd.DynamicService.Create(unstructured)
+		summary, err := repo.DownloadContents(ctx, contents, dir)
 		if err != nil {
 			return err
 		}
+		log.Info(fmt.Sprintf("Downloaded %d files (%d bytes) of %s at %s in %s", summary.Files, summary.Bytes, repo.FullName(), revision, summary.Duration))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	kustomizeOptions, err := cd.kustomizeOptions(component)
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := kustomize.LoadFs(dir)
+	if err != nil {
+		return nil, err
+	}
+	err = kustomize.ValidateFunctions(fsys, kustomizeOptions)
+	if err != nil {
+		return nil, err
+	}
+	chart, err := renderChart(fsys, filepath.Join(string(filepath.Separator), repo.Path()), component)
+	if err != nil {
+		return nil, err
+	}
+	chart, err = kustomize.Prepare(fsys, chart, directoryOptions(component))
+	if err != nil {
+		return nil, err
+	}
+	chart, err = kustomize.Wrap(fsys, chart, kustomizeOverrides(component))
+	if err != nil {
+		return nil, err
+	}
+	kustomizeWrapper := kustomize.New(fsys, kustomizeOptions)
+	response, err := kustomizeWrapper.RenderManifests(chart)
+	if err != nil {
+		return nil, err
+	}
+	var objects []unstructured.Unstructured
+	for _, resource := range response.Resources() {
+		resourceBytes, err := json.Marshal(resource)
+		if err != nil {
+			return nil, err
+		}
+		object := unstructured.Unstructured{}
+		err = json.Unmarshal(resourceBytes, &object)
+		if err != nil {
+			return nil, err
+		}
+		if common.SubstitutionEnabled(component) {
+			err = substitute.Object(object.Object, variables, component.SubstituteStrict)
+			if err != nil {
+				return nil, fmt.Errorf("error substituting variables of %s: %w", resource.CurId(), err)
+			}
+		}
+		setComponentNamespace(&object, resource.GetGvk(), component.Namespace)
+		common.CreateOwnerReference(&object, charlesDeployment)
+		setComponentLabels(&object, charlesDeployment, component.Name)
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// setComponentNamespace moves the object to the component namespace when the source leaves its namespace
+// empty. Kinds kustomize does not know to be cluster scoped are assumed namespaced, the API server dropping
+// the namespace of the cluster scoped ones.
+func setComponentNamespace(object *unstructured.Unstructured, gvk resid.Gvk, namespace string) {
+	if object.GetNamespace() == "" && !gvk.IsClusterScoped() {
+		object.SetNamespace(namespace)
+	}
+}
+
+func hookStatuses(results []k8s.HookResult) []iocharlescdv1.HookStatus {
+	var statuses []iocharlescdv1.HookStatus
+	for _, result := range results {
+		status := iocharlescdv1.HookStatus{
+			Kind:       result.Resource.GetKind(),
+			Name:       result.Resource.GetName(),
+			Hook:       result.Hook,
+			Result:     "Succeeded",
+			FinishedAt: metav1.NewTime(result.FinishedAt),
+		}
+		if result.Err != nil {
+			status.Result = "Failed"
+			status.Message = result.Err.Error()
+		}
+		statuses = append(statuses, status)
 	}
-	return nil
+	return statuses
 }
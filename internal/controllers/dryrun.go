@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
+	"github.com/thalleslmF/go-operator/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/yaml"
+)
+
+// dryRunReportKey is the key of the dry run ConfigMap holding the report
+const dryRunReportKey = "report.yaml"
+
+// dryRunReport is what applying the components would do
+type dryRunReport struct {
+	Components map[string]k8s.Diff   `json:"components"`
+	Pruned     []k8s.ObjectReference `json:"pruned,omitempty"`
+}
+
+func dryRunConfigMapName(charlesDeployment iocharlescdv1.CharlesDeployment) string {
+	return fmt.Sprintf("%s-dry-run", charlesDeployment.Name)
+}
+
+// DryRun renders every component and diffs it against the cluster with server side dry run applies,
+// listing the objects a sync would prune, and writing the report to a ConfigMap owned by the deployment and its summary to the status.
+// Neither the ConfigMap nor the status, compared to observed, is written when the report did not change.
+func (cd *CharlesDeploymentController) DryRun(ctx context.Context, charlesDeployment *iocharlescdv1.CharlesDeployment, observed iocharlescdv1.CharlesDeploymentStatus) error {
+	report := dryRunReport{Components: make(map[string]k8s.Diff, len(charlesDeployment.Spec.Components))}
+	revisions := make(map[string]string, len(charlesDeployment.Spec.Components))
+	for _, component := range charlesDeployment.Spec.Components {
+		repo, revision, variables, err := cd.resolveComponent(ctx, component, charlesDeployment.Namespace)
+		if err != nil {
+			return err
+		}
+		objects, err := cd.renderComponent(ctx, repo, revision, component, variables, *charlesDeployment)
+		if err != nil {
+			return err
+		}
+		diff, err := cd.DynamicService.Diff(ctx, objects)
+		if err != nil {
+			return fmt.Errorf("error diffing component %s: %w", component.Name, err)
+		}
+		report.Components[component.Name] = diff
+		revisions[component.Name] = revision
+		orphans, err := cd.componentOrphans(ctx, *charlesDeployment, component.Name, objects)
+		if err != nil {
+			return err
+		}
+		report.Pruned = append(report.Pruned, orphans...)
+	}
+	for _, name := range removedComponents(*charlesDeployment) {
+		orphans, err := cd.componentOrphans(ctx, *charlesDeployment, name, nil)
+		if err != nil {
+			return err
+		}
+		report.Pruned = append(report.Pruned, orphans...)
+	}
+	configMapName := dryRunConfigMapName(*charlesDeployment)
+	content, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: configMapName, Namespace: charlesDeployment.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(ctx, cd.Client, configMap, func() error {
+		configMap.Data = map[string]string{dryRunReportKey: string(content)}
+		return controllerutil.SetControllerReference(charlesDeployment, configMap, cd.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("error writing the dry run report: %w", err)
+	}
+	status := &iocharlescdv1.DryRunStatus{
+		ConfigMapName: configMapName,
+		Pruned:        int32(len(report.Pruned)),
+		Revisions:     revisions,
+	}
+	for _, diff := range report.Components {
+		status.Created += int32(len(diff.Created))
+		status.Changed += int32(len(diff.Changed))
+	}
+	if previous := charlesDeployment.Status.DryRun; previous != nil {
+		status.Time = previous.Time
+	}
+	if !equality.Semantic.DeepEqual(status, charlesDeployment.Status.DryRun) {
+		status.Time = metav1.Now()
+	}
+	charlesDeployment.Status.DryRun = status
+	if equality.Semantic.DeepEqual(charlesDeployment.Status, observed) {
+		return nil
+	}
+	return cd.Status().Update(ctx, charlesDeployment)
+}
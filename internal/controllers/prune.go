@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
+	"github.com/thalleslmF/go-operator/internal/common"
+	"github.com/thalleslmF/go-operator/internal/k8s"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// setComponentLabels marks the object as applied for the component, which is how its orphans are found
+func setComponentLabels(object *unstructured.Unstructured, charlesDeployment iocharlescdv1.CharlesDeployment, componentName string) {
+	objectLabels := object.GetLabels()
+	if objectLabels == nil {
+		objectLabels = make(map[string]string)
+	}
+	objectLabels[iocharlescdv1.DeploymentLabel] = charlesDeployment.Name
+	objectLabels[iocharlescdv1.ComponentLabel] = componentName
+	object.SetLabels(objectLabels)
+}
+
+func componentSelector(charlesDeployment iocharlescdv1.CharlesDeployment, componentName string) string {
+	return labels.SelectorFromSet(labels.Set{
+		iocharlescdv1.DeploymentLabel: charlesDeployment.Name,
+		iocharlescdv1.ComponentLabel:  componentName,
+	}).String()
+}
+
+// componentOrphans lists the objects applied for the component, of the kinds recorded in its status or
+// rendered now, that are no longer rendered
+func (cd *CharlesDeploymentController) componentOrphans(ctx context.Context, charlesDeployment iocharlescdv1.CharlesDeployment, componentName string, rendered []unstructured.Unstructured) ([]k8s.ObjectReference, error) {
+	var kinds []k8s.ObjectReference
+	if componentStatus := common.FindComponentStatus(charlesDeployment.Status, componentName); componentStatus != nil {
+		for _, kind := range componentStatus.AppliedKinds {
+			kinds = append(kinds, k8s.ObjectReference{APIVersion: kind.APIVersion, Kind: kind.Kind, Namespace: kind.Namespace})
+		}
+	}
+	return cd.DynamicService.Orphans(ctx, charlesDeployment.UID, componentSelector(charlesDeployment, componentName), kinds, rendered)
+}
+
+// pruneRemovedComponents deletes the objects of the components removed from the spec, dropping their status
+func (cd *CharlesDeploymentController) pruneRemovedComponents(ctx context.Context, charlesDeployment *iocharlescdv1.CharlesDeployment) error {
+	for _, name := range removedComponents(*charlesDeployment) {
+		orphans, err := cd.componentOrphans(ctx, *charlesDeployment, name, nil)
+		if err != nil {
+			return fmt.Errorf("error pruning removed component %s: %w", name, err)
+		}
+		err = cd.DynamicService.Prune(ctx, orphans)
+		if err != nil {
+			return fmt.Errorf("error pruning removed component %s: %w", name, err)
+		}
+		common.RemoveComponentStatus(&charlesDeployment.Status, name)
+	}
+	return nil
+}
+
+// removedComponents returns the components with a status that are no longer in the spec
+func removedComponents(charlesDeployment iocharlescdv1.CharlesDeployment) []string {
+	var removed []string
+	for _, componentStatus := range charlesDeployment.Status.Components {
+		found := false
+		for _, component := range charlesDeployment.Spec.Components {
+			if component.Name == componentStatus.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, componentStatus.Name)
+		}
+	}
+	return removed
+}
+
+// appliedKinds merges the kinds of the resources into the kinds already recorded
+func appliedKinds(recorded []iocharlescdv1.AppliedKind, resources []unstructured.Unstructured) []iocharlescdv1.AppliedKind {
+	kinds := append([]iocharlescdv1.AppliedKind(nil), recorded...)
+	for _, kind := range k8s.Kinds(resources) {
+		appliedKind := iocharlescdv1.AppliedKind{APIVersion: kind.APIVersion, Kind: kind.Kind, Namespace: kind.Namespace}
+		found := false
+		for _, existing := range kinds {
+			if existing == appliedKind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			kinds = append(kinds, appliedKind)
+		}
+	}
+	return kinds
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"testing"
+)
+
+func TestSetComponentNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		gvk       resid.Gvk
+		namespace string
+		expected  string
+	}{
+		{name: "namespaced kind", gvk: resid.NewGvk("apps", "v1", "Deployment"), expected: "component"},
+		{name: "explicit namespace", gvk: resid.NewGvk("", "v1", "ConfigMap"), namespace: "source", expected: "source"},
+		{name: "cluster scoped kind", gvk: resid.NewGvk("rbac.authorization.k8s.io", "v1", "ClusterRole"), expected: ""},
+		{name: "namespace", gvk: resid.NewGvk("", "v1", "Namespace"), expected: ""},
+		{name: "custom kind", gvk: resid.NewGvk("example.com", "v1", "Widget"), expected: "component"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			object := unstructured.Unstructured{}
+			object.SetNamespace(test.namespace)
+
+			setComponentNamespace(&object, test.gvk, "component")
+
+			if object.GetNamespace() != test.expected {
+				t.Errorf("expected namespace %q, got %q", test.expected, object.GetNamespace())
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+	"time"
+)
+
+func testController(t *testing.T, deployment *iocharlescdv1.CharlesDeployment) *CharlesDeploymentController {
+	scheme := runtime.NewScheme()
+	if err := iocharlescdv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return &CharlesDeploymentController{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(deployment).Build(),
+		Scheme: scheme,
+	}
+}
+
+func testDeployment(annotations map[string]string) *iocharlescdv1.CharlesDeployment {
+	return &iocharlescdv1.CharlesDeployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", Annotations: annotations},
+	}
+}
+
+func syncDeployment(t *testing.T, controller *CharlesDeploymentController) (iocharlescdv1.CharlesDeployment, time.Duration) {
+	key := client.ObjectKey{Namespace: "default", Name: "app"}
+	result, err := controller.Sync(context.Background(), key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	deployment := iocharlescdv1.CharlesDeployment{}
+	err = controller.Get(context.Background(), key, &deployment)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return deployment, result.RequeueAfter
+}
+
+func TestSyncSetsSuspendedCondition(t *testing.T) {
+	tests := []struct {
+		name        string
+		suspend     bool
+		annotations map[string]string
+		status      metav1.ConditionStatus
+		reason      string
+	}{
+		{name: "spec", suspend: true, status: metav1.ConditionTrue, reason: "SpecSuspended"},
+		{
+			name:        "annotation",
+			annotations: map[string]string{iocharlescdv1.ReconcileAnnotation: iocharlescdv1.ReconcileDisabled},
+			status:      metav1.ConditionTrue,
+			reason:      "ReconcileAnnotationDisabled",
+		},
+		{name: "enabled", status: metav1.ConditionFalse, reason: "ReconciliationEnabled"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployment := testDeployment(test.annotations)
+			deployment.Spec.Suspend = test.suspend
+			controller := testController(t, deployment)
+
+			synced, _ := syncDeployment(t, controller)
+
+			condition := apimeta.FindStatusCondition(synced.Status.Conditions, iocharlescdv1.SuspendedCondition)
+			if condition == nil || condition.Status != test.status || condition.Reason != test.reason {
+				t.Errorf("expected a %s Suspended condition with reason %s, got %+v", test.status, test.reason, condition)
+			}
+		})
+	}
+}
+
+func TestSyncOnlyWritesSuspendedConditionOnce(t *testing.T) {
+	deployment := testDeployment(nil)
+	deployment.Spec.Suspend = true
+	controller := testController(t, deployment)
+	first, _ := syncDeployment(t, controller)
+
+	second, _ := syncDeployment(t, controller)
+
+	if first.ResourceVersion != second.ResourceVersion {
+		t.Errorf("expected the status not to be written again, got resource versions %s and %s", first.ResourceVersion, second.ResourceVersion)
+	}
+}
+
+func TestSyncHandlesSyncRequestOnce(t *testing.T) {
+	controller := testController(t, testDeployment(map[string]string{iocharlescdv1.SyncRequestedAtAnnotation: "2021-10-01T00:00:00Z"}))
+
+	synced, _ := syncDeployment(t, controller)
+
+	if synced.Status.LastHandledSyncRequest != "2021-10-01T00:00:00Z" {
+		t.Fatalf("expected the sync request to be handled, got %q", synced.Status.LastHandledSyncRequest)
+	}
+	if _, requested := synced.SyncRequest(); requested {
+		t.Errorf("expected the handled sync request not to be requested again")
+	}
+}
+
+func TestSyncRequeuesAfterSyncInterval(t *testing.T) {
+	deployment := testDeployment(nil)
+	deployment.Spec.SyncInterval = &metav1.Duration{Duration: time.Minute}
+	controller := testController(t, deployment)
+
+	_, requeueAfter := syncDeployment(t, controller)
+
+	if requeueAfter < time.Minute || requeueAfter > time.Minute+time.Minute/10 {
+		t.Errorf("expected to requeue after about a minute, got %s", requeueAfter)
+	}
+}
+
+func TestRequeueAfterSyncInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval *metav1.Duration
+		min      time.Duration
+		max      time.Duration
+	}{
+		{name: "disabled"},
+		{name: "zero", interval: &metav1.Duration{}},
+		{name: "negative", interval: &metav1.Duration{Duration: -time.Minute}},
+		{name: "jittered", interval: &metav1.Duration{Duration: time.Minute}, min: time.Minute, max: time.Minute + 6*time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployment := testDeployment(nil)
+			deployment.Spec.SyncInterval = test.interval
+			requeues := make(map[time.Duration]bool)
+
+			for i := 0; i < 100; i++ {
+				requeueAfter := requeueAfterSyncInterval(*deployment).RequeueAfter
+				if requeueAfter < test.min || requeueAfter > test.max {
+					t.Fatalf("expected to requeue between %s and %s, got %s", test.min, test.max, requeueAfter)
+				}
+				requeues[requeueAfter] = true
+			}
+
+			if test.max > 0 && len(requeues) == 1 {
+				t.Errorf("expected the requeues to be jittered")
+			}
+		})
+	}
+}
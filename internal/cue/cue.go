@@ -0,0 +1,94 @@
+package cue
+
+import (
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/load"
+	"fmt"
+	"github.com/thalleslmF/go-operator/internal/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sort"
+)
+
+// Options configure the evaluation of a CUE package
+type Options struct {
+	// Package is relative to the chart, the chart directory when empty
+	Package    string
+	Expression string
+	Tags       map[string]string
+}
+
+// Render evaluates the package found in the chart directory of fsys and returns the objects
+// selected by the expression as a multi-document manifest. Every cue file of the source is
+// overlaid under a root that does not exist on disk so the loader never sees the operator disk.
+func Render(fsys filesys.FileSystem, chart string, options Options) ([]byte, error) {
+	if !fsys.IsDir(chart) {
+		return nil, fmt.Errorf("cue chart %s not found in source", chart)
+	}
+	root, err := isolatedRoot()
+	if err != nil {
+		return nil, err
+	}
+	overlay, err := overlay(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	pkg := options.Package
+	if pkg == "" {
+		pkg = "."
+	}
+	tags := make([]string, 0, len(options.Tags))
+	for name, value := range options.Tags {
+		tags = append(tags, fmt.Sprintf("%s=%s", name, value))
+	}
+	sort.Strings(tags)
+	instances := load.Instances([]string{pkg}, &load.Config{Dir: filepath.Join(root, chart), Overlay: overlay, Tags: tags})
+	if len(instances) != 1 {
+		return nil, fmt.Errorf("cue package %s of %s must load a single instance, got %d", pkg, chart, len(instances))
+	}
+	if instances[0].Err != nil {
+		return nil, fmt.Errorf("error loading cue package %s: %w", pkg, instances[0].Err)
+	}
+	value := cuecontext.New().BuildInstance(instances[0])
+	if options.Expression != "" {
+		value = value.LookupPath(cue.ParsePath(options.Expression))
+	}
+	err = value.Validate(cue.Concrete(true))
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating cue package %s: %w", pkg, err)
+	}
+	output, err := value.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return common.ManifestsFromJSON(output)
+}
+
+// isolatedRoot returns a unique directory that does not exist, the loader falls back to
+// the disk for anything missing from the overlay and must find nothing there
+func isolatedRoot() (string, error) {
+	root, err := ioutil.TempDir("", "charles-cue-")
+	if err != nil {
+		return "", err
+	}
+	return root, os.Remove(root)
+}
+
+func overlay(fsys filesys.FileSystem, root string) (map[string]load.Source, error) {
+	overlay := make(map[string]load.Source)
+	err := fsys.Walk(string(filepath.Separator), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".cue" {
+			return err
+		}
+		content, err := fsys.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		overlay[filepath.Join(root, path)] = load.FromBytes(content)
+		return nil
+	})
+	return overlay, err
+}
@@ -0,0 +1,84 @@
+package cue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	fsys := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/cue.mod/module.cue": `module: "example.com/app"`,
+		"/lib/names.cue":      "package lib\nprefix: \"app\"\n",
+		"/app/app.cue": `package app
+
+import "example.com/app/lib"
+
+env: *"dev" | string @tag(env)
+objects: config: {
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: "\(lib.prefix)-\(env)"
+}
+`,
+	}
+	for path, content := range files {
+		if err := fsys.WriteFile(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifests, err := Render(fsys, "/app", Options{Expression: "objects", Tags: map[string]string{"env": "prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifests), `"name":"app-prod"`) {
+		t.Errorf("expected the imported prefix and the tag in the manifests, got %s", manifests)
+	}
+}
+
+func TestRenderOnlyLoadsTheSource(t *testing.T) {
+	host, err := ioutil.TempDir("", "cue-host-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(host)
+	err = ioutil.WriteFile(filepath.Join(host, "host.cue"), []byte("package app\nhost: {apiVersion: \"v1\", kind: \"ConfigMap\", metadata: name: \"host\"}\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := filesys.MakeFsInMemory()
+	err = fsys.WriteFile(filepath.Join(host, "app.cue"), []byte("package app\nsource: {apiVersion: \"v1\", kind: \"ConfigMap\", metadata: name: \"source\"}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifests, err := Render(fsys, host, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(manifests), `"host"`) || !strings.Contains(string(manifests), `"name":"source"`) {
+		t.Errorf("expected only the source files to be rendered, got %s", manifests)
+	}
+}
+
+func TestRenderMissingChart(t *testing.T) {
+	host, err := ioutil.TempDir("", "cue-host-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(host)
+	err = ioutil.WriteFile(filepath.Join(host, "host.cue"), []byte("package app\nhost: {apiVersion: \"v1\", kind: \"ConfigMap\", metadata: name: \"host\"}\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Render(filesys.MakeFsInMemory(), host, Options{})
+	if err == nil || !strings.Contains(err.Error(), "not found in source") {
+		t.Errorf("expected a missing chart error, got %v", err)
+	}
+}
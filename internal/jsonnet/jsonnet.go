@@ -0,0 +1,90 @@
+package jsonnet
+
+import (
+	"fmt"
+	"github.com/google/go-jsonnet"
+	"github.com/thalleslmF/go-operator/internal/common"
+	"path/filepath"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sync"
+)
+
+// Options configure the evaluation of a jsonnet entrypoint
+type Options struct {
+	// Entrypoint is the file evaluated, relative to the chart
+	Entrypoint string
+	ExtVars    map[string]string
+	TLAs       map[string]string
+	// JPaths are library directories of the source searched by imports
+	JPaths []string
+}
+
+// Render evaluates the entrypoint found in the chart directory of fsys and returns the objects it outputs as a multi-document manifest
+func Render(fsys filesys.FileSystem, chart string, options Options) ([]byte, error) {
+	if options.Entrypoint == "" {
+		return nil, fmt.Errorf("jsonnet entrypoint of %s is required", chart)
+	}
+	entrypoint := filepath.Join(chart, options.Entrypoint)
+	if !fsys.Exists(entrypoint) || fsys.IsDir(entrypoint) {
+		return nil, fmt.Errorf("jsonnet entrypoint %s not found in %s", options.Entrypoint, chart)
+	}
+	vm := jsonnet.MakeVM()
+	vm.Importer(&importer{fsys: fsys, jpaths: options.JPaths, contents: make(map[string]jsonnet.Contents)})
+	for name, value := range options.ExtVars {
+		vm.ExtVar(name, value)
+	}
+	for name, value := range options.TLAs {
+		vm.TLAVar(name, value)
+	}
+	output, err := vm.EvaluateFile(entrypoint)
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating jsonnet %s: %w", options.Entrypoint, err)
+	}
+	return common.ManifestsFromJSON([]byte(output))
+}
+
+// importer resolves imports inside the source, relative to the importing file then in the jpaths
+type importer struct {
+	fsys     filesys.FileSystem
+	jpaths   []string
+	mutex    sync.Mutex
+	contents map[string]jsonnet.Contents
+}
+
+func (i *importer) Import(importedFrom string, importedPath string) (jsonnet.Contents, string, error) {
+	candidates := []string{importedPath}
+	if !filepath.IsAbs(importedPath) {
+		candidates = []string{filepath.Join(filepath.Dir(importedFrom), importedPath)}
+		for _, jpath := range i.jpaths {
+			candidates = append(candidates, filepath.Join(string(filepath.Separator), jpath, importedPath))
+		}
+	}
+	for _, candidate := range candidates {
+		contents, ok, err := i.read(filepath.Clean(candidate))
+		if err != nil {
+			return jsonnet.Contents{}, "", err
+		}
+		if ok {
+			return contents, filepath.Clean(candidate), nil
+		}
+	}
+	return jsonnet.Contents{}, "", fmt.Errorf("couldn't find import %s from %s", importedPath, importedFrom)
+}
+
+func (i *importer) read(path string) (jsonnet.Contents, bool, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if contents, ok := i.contents[path]; ok {
+		return contents, true, nil
+	}
+	if !i.fsys.Exists(path) || i.fsys.IsDir(path) {
+		return jsonnet.Contents{}, false, nil
+	}
+	content, err := i.fsys.ReadFile(path)
+	if err != nil {
+		return jsonnet.Contents{}, false, err
+	}
+	contents := jsonnet.MakeContents(string(content))
+	i.contents[path] = contents
+	return contents, true, nil
+}
@@ -0,0 +1,76 @@
+package jsonnet
+
+import (
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	fsys := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/lib/names.libsonnet":  `{ prefix: "app" }`,
+		"/app/params.libsonnet": `{ replicas: 2 }`,
+		"/app/main.jsonnet": `
+local names = import "names.libsonnet";
+local params = import "params.libsonnet";
+function(env) {
+  config: {
+    apiVersion: "v1",
+    kind: "ConfigMap",
+    metadata: { name: names.prefix + "-" + env + "-" + std.extVar("region") },
+    data: { replicas: std.toString(params.replicas) },
+  },
+}
+`,
+	}
+	for path, content := range files {
+		if err := fsys.WriteFile(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifests, err := Render(fsys, "/app", Options{
+		Entrypoint: "main.jsonnet",
+		ExtVars:    map[string]string{"region": "eu"},
+		TLAs:       map[string]string{"env": "prod"},
+		JPaths:     []string{"lib"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifests), `"name":"app-prod-eu"`) || !strings.Contains(string(manifests), `"replicas":"2"`) {
+		t.Errorf("expected the imports and variables in the manifests, got %s", manifests)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	fsys := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/main.jsonnet":   `{}`,
+		"/app/import.jsonnet": `import "/etc/hostname"`,
+	}
+	for path, content := range files {
+		if err := fsys.WriteFile(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name       string
+		entrypoint string
+		expected   string
+	}{
+		{name: "no entrypoint", expected: "entrypoint of /app is required"},
+		{name: "missing entrypoint", entrypoint: "missing.jsonnet", expected: "entrypoint missing.jsonnet not found in /app"},
+		{name: "entrypoint is a directory", entrypoint: ".", expected: "entrypoint . not found in /app"},
+		{name: "import outside the source", entrypoint: "import.jsonnet", expected: "couldn't find import /etc/hostname"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Render(fsys, "/app", Options{Entrypoint: test.entrypoint})
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"reflect"
+	"sort"
+)
+
+// ignoredFields are set by the API server and not part of a diff
+var ignoredFields = map[string]bool{
+	".metadata.managedFields":     true,
+	".metadata.resourceVersion":   true,
+	".metadata.generation":        true,
+	".metadata.uid":               true,
+	".metadata.creationTimestamp": true,
+	".metadata.selfLink":          true,
+	".status":                     true,
+}
+
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// FieldChange is a field whose value differs, Old or New being nil when it is added or removed
+type FieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+type ObjectChange struct {
+	ObjectReference
+	Fields []FieldChange `json:"fields"`
+}
+
+// Diff lists the objects an apply would create and the fields it would change
+type Diff struct {
+	Created []ObjectReference `json:"created,omitempty"`
+	Changed []ObjectChange    `json:"changed,omitempty"`
+}
+
+func Reference(resource unstructured.Unstructured) ObjectReference {
+	return ObjectReference{
+		APIVersion: resource.GetAPIVersion(),
+		Kind:       resource.GetKind(),
+		Namespace:  resource.GetNamespace(),
+		Name:       resource.GetName(),
+	}
+}
+
+// Diff server side applies the resources in dry run mode, the way Apply does, and compares the result to the live objects.
+// Resources whose kind is not served yet, typically instances of a CustomResourceDefinition rendered
+// alongside them, are reported created without being sent to the API server.
+func (s DynamicService) Diff(ctx context.Context, resources []unstructured.Unstructured) (Diff, error) {
+	diff := Diff{}
+	for _, resource := range resources {
+		client, err := s.resourceClient(resource)
+		if isNoMatch(err) {
+			diff.Created = append(diff.Created, Reference(resource))
+			continue
+		}
+		if err != nil {
+			return Diff{}, err
+		}
+		live, err := client.Get(ctx, resource.GetName(), v1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			live = nil
+		} else if err != nil {
+			return Diff{}, err
+		}
+		applied, err := s.apply(ctx, resource, true)
+		if err != nil {
+			return Diff{}, fmt.Errorf("error applying %s/%s in dry run: %w", resource.GetKind(), resource.GetName(), err)
+		}
+		if live == nil {
+			diff.Created = append(diff.Created, Reference(resource))
+			continue
+		}
+		var fields []FieldChange
+		diffFields("", live.Object, applied.Object, &fields)
+		if len(fields) > 0 {
+			diff.Changed = append(diff.Changed, ObjectChange{ObjectReference: Reference(resource), Fields: fields})
+		}
+	}
+	return diff, nil
+}
+
+// Kinds returns the kinds of the resources with their namespaces, Name being left empty
+func Kinds(resources []unstructured.Unstructured) []ObjectReference {
+	seen := make(map[ObjectReference]bool)
+	var kinds []ObjectReference
+	for _, resource := range resources {
+		kind := Reference(resource)
+		kind.Name = ""
+		if !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// Orphans lists the objects matching the label selector and owned by owner that are no longer rendered,
+// searching the given kinds along with the kinds of the rendered resources
+func (s DynamicService) Orphans(ctx context.Context, owner types.UID, selector string, kinds []ObjectReference, rendered []unstructured.Unstructured) ([]ObjectReference, error) {
+	renderedReferences := make(map[ObjectReference]bool, len(rendered))
+	for _, resource := range rendered {
+		renderedReferences[Reference(resource)] = true
+	}
+	listed := make(map[ObjectReference]bool)
+	var orphans []ObjectReference
+	for _, kind := range append(kinds, Kinds(rendered)...) {
+		kind.Name = ""
+		if listed[kind] {
+			continue
+		}
+		listed[kind] = true
+		resource := unstructured.Unstructured{}
+		resource.SetAPIVersion(kind.APIVersion)
+		resource.SetKind(kind.Kind)
+		resource.SetNamespace(kind.Namespace)
+		client, err := s.resourceClient(resource)
+		if isNoMatch(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list, err := client.List(ctx, v1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			if isOwnedBy(item, owner) && !renderedReferences[Reference(item)] {
+				orphans = append(orphans, Reference(item))
+			}
+		}
+	}
+	return orphans, nil
+}
+
+// Prune deletes the objects
+func (s DynamicService) Prune(ctx context.Context, objects []ObjectReference) error {
+	for _, object := range objects {
+		resource := unstructured.Unstructured{}
+		resource.SetAPIVersion(object.APIVersion)
+		resource.SetKind(object.Kind)
+		resource.SetNamespace(object.Namespace)
+		resource.SetName(object.Name)
+		err := s.delete(ctx, resource)
+		if isNoMatch(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error pruning %s/%s: %w", object.Kind, object.Name, err)
+		}
+	}
+	return nil
+}
+
+// isNoMatch tells whether the error comes from a kind the API server does not serve
+func isNoMatch(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if meta.IsNoMatchError(err) {
+			return true
+		}
+	}
+	return false
+}
+
+func isOwnedBy(resource unstructured.Unstructured, owner types.UID) bool {
+	for _, ownerReference := range resource.GetOwnerReferences() {
+		if ownerReference.UID == owner {
+			return true
+		}
+	}
+	return false
+}
+
+// diffFields appends the changes between two values, walking into the objects they have in common
+func diffFields(path string, old, new interface{}, changes *[]FieldChange) {
+	if ignoredFields[path] {
+		return
+	}
+	oldObject, oldIsObject := old.(map[string]interface{})
+	newObject, newIsObject := new.(map[string]interface{})
+	if !oldIsObject || !newIsObject {
+		if !reflect.DeepEqual(old, new) {
+			*changes = append(*changes, FieldChange{Path: path, Old: old, New: new})
+		}
+		return
+	}
+	keys := make(map[string]bool, len(oldObject)+len(newObject))
+	for key := range oldObject {
+		keys[key] = true
+	}
+	for key := range newObject {
+		keys[key] = true
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+	for _, key := range sortedKeys {
+		diffFields(fmt.Sprintf("%s.%s", path, key), oldObject[key], newObject[key], changes)
+	}
+}
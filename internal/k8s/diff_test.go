@@ -0,0 +1,126 @@
+package k8s
+
+import (
+	"context"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"reflect"
+	"testing"
+)
+
+func ownedConfigMap(name string, labels map[string]string, owner types.UID) *unstructured.Unstructured {
+	resource := configMap("value")
+	resource.SetName(name)
+	resource.SetLabels(labels)
+	resource.SetOwnerReferences([]v1.OwnerReference{{APIVersion: "charlescd.io/v1", Kind: "CharlesDeployment", Name: "deployment", UID: owner}})
+	return resource
+}
+
+func TestOrphans(t *testing.T) {
+	component := map[string]string{"charlescd.io/component": "backend"}
+	other := map[string]string{"charlescd.io/component": "frontend"}
+	service, _ := newTestService(t,
+		ownedConfigMap("rendered", component, "owner"),
+		ownedConfigMap("removed", component, "owner"),
+		ownedConfigMap("other-component", other, "owner"),
+		ownedConfigMap("other-owner", component, "other"),
+	)
+	rendered := ownedConfigMap("rendered", component, "owner")
+	tests := []struct {
+		name     string
+		kinds    []ObjectReference
+		rendered []unstructured.Unstructured
+		want     []ObjectReference
+	}{
+		{
+			name:     "kind still rendered",
+			rendered: []unstructured.Unstructured{*rendered},
+			want:     []ObjectReference{{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "removed"}},
+		},
+		{
+			name:  "kind no longer rendered",
+			kinds: []ObjectReference{{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default"}},
+			want: []ObjectReference{
+				{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "removed"},
+				{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "rendered"},
+			},
+		},
+		{
+			name: "no kinds",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			orphans, err := service.Orphans(context.Background(), "owner", "charlescd.io/component=backend", test.kinds, test.rendered)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(orphans, test.want) {
+				t.Errorf("expected orphans %v, got %v", test.want, orphans)
+			}
+		})
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      map[string]interface{}
+		new      map[string]interface{}
+		expected []FieldChange
+	}{
+		{
+			name: "unchanged",
+			old:  map[string]interface{}{"data": map[string]interface{}{"key": "value"}},
+			new:  map[string]interface{}{"data": map[string]interface{}{"key": "value"}},
+		},
+		{
+			name: "changed, added and removed fields sorted by path",
+			old:  map[string]interface{}{"data": map[string]interface{}{"removed": "value", "key": "old"}},
+			new:  map[string]interface{}{"data": map[string]interface{}{"key": "new", "added": "value"}},
+			expected: []FieldChange{
+				{Path: ".data.added", New: "value"},
+				{Path: ".data.key", Old: "old", New: "new"},
+				{Path: ".data.removed", Old: "value"},
+			},
+		},
+		{
+			name: "lists compared as a whole",
+			old:  map[string]interface{}{"spec": map[string]interface{}{"args": []interface{}{"--a", "--b"}}},
+			new:  map[string]interface{}{"spec": map[string]interface{}{"args": []interface{}{"--a", "--c"}}},
+			expected: []FieldChange{
+				{Path: ".spec.args", Old: []interface{}{"--a", "--b"}, New: []interface{}{"--a", "--c"}},
+			},
+		},
+		{
+			name: "object replacing a value",
+			old:  map[string]interface{}{"data": "value"},
+			new:  map[string]interface{}{"data": map[string]interface{}{"key": "value"}},
+			expected: []FieldChange{
+				{Path: ".data", Old: "value", New: map[string]interface{}{"key": "value"}},
+			},
+		},
+		{
+			name: "server fields ignored",
+			old: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "settings", "resourceVersion": "1", "uid": "a", "managedFields": []interface{}{}},
+				"status":   map[string]interface{}{"ready": true},
+			},
+			new: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "settings", "resourceVersion": "2", "uid": "b"},
+				"status":   map[string]interface{}{"ready": false},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var changes []FieldChange
+			diffFields("", test.old, test.new, &changes)
+
+			if !reflect.DeepEqual(changes, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, changes)
+			}
+		})
+	}
+}
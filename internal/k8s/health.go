@@ -0,0 +1,79 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// health tells whether the workload is rolled out, a Job completed or a Pod succeeded or ready,
+// returning the reason it is not and an error once it failed. Other kinds are healthy once created.
+func health(resource unstructured.Unstructured) (bool, string, error) {
+	generation := resource.GetGeneration()
+	observedGeneration, _, _ := unstructured.NestedInt64(resource.Object, "status", "observedGeneration")
+	switch resource.GetKind() {
+	case "Deployment", "StatefulSet", "ReplicaSet":
+		if observedGeneration < generation {
+			return false, "waiting for the spec to be observed", nil
+		}
+		replicas, ok, _ := unstructured.NestedInt64(resource.Object, "spec", "replicas")
+		if !ok {
+			replicas = 1
+		}
+		ready, _, _ := unstructured.NestedInt64(resource.Object, "status", "readyReplicas")
+		updated, hasUpdated, _ := unstructured.NestedInt64(resource.Object, "status", "updatedReplicas")
+		if hasUpdated && updated < replicas {
+			return false, fmt.Sprintf("%d of %d replicas updated", updated, replicas), nil
+		}
+		if ready < replicas {
+			return false, fmt.Sprintf("%d of %d replicas ready", ready, replicas), nil
+		}
+		return true, "", nil
+	case "DaemonSet":
+		if observedGeneration < generation {
+			return false, "waiting for the spec to be observed", nil
+		}
+		desired, _, _ := unstructured.NestedInt64(resource.Object, "status", "desiredNumberScheduled")
+		updated, _, _ := unstructured.NestedInt64(resource.Object, "status", "updatedNumberScheduled")
+		ready, _, _ := unstructured.NestedInt64(resource.Object, "status", "numberReady")
+		if updated < desired || ready < desired {
+			return false, fmt.Sprintf("%d of %d pods ready", ready, desired), nil
+		}
+		return true, "", nil
+	case "Job":
+		if message, ok := condition(resource, "Failed"); ok {
+			return false, "", errors.New(message)
+		}
+		if _, ok := condition(resource, "Complete"); ok {
+			return true, "", nil
+		}
+		return false, "waiting for the job to complete", nil
+	case "Pod":
+		phase, _, _ := unstructured.NestedString(resource.Object, "status", "phase")
+		switch phase {
+		case "Succeeded":
+			return true, "", nil
+		case "Failed":
+			message, _, _ := unstructured.NestedString(resource.Object, "status", "message")
+			return false, "", fmt.Errorf("pod failed: %s", message)
+		}
+		if _, ok := condition(resource, "Ready"); ok {
+			return true, "", nil
+		}
+		return false, fmt.Sprintf("pod is %s", phase), nil
+	}
+	return true, "", nil
+}
+
+// condition returns the message of the condition when it is True
+func condition(resource unstructured.Unstructured, conditionType string) (string, bool) {
+	conditions, _, _ := unstructured.NestedSlice(resource.Object, "status", "conditions")
+	for _, item := range conditions {
+		fields, ok := item.(map[string]interface{})
+		if ok && fields["type"] == conditionType && fields["status"] == "True" {
+			message, _ := fields["message"].(string)
+			return message, true
+		}
+	}
+	return "", false
+}
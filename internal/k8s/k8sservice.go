@@ -2,38 +2,142 @@ package k8s
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/prometheus/common/log"
 	"github.com/thalleslmF/go-operator/internal/common"
-	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/utils/pointer"
+	"time"
 )
 
+// FieldManager owns the fields applied by the operator
+const FieldManager = "charles-operator"
+
+const (
+	establishedPollInterval = time.Second
+	establishedTimeout      = time.Minute
+)
+
+var customResourceDefinitions = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// RESTMapper maps kinds to resources, and is reset to learn the kinds of new CustomResourceDefinitions
+type RESTMapper interface {
+	meta.RESTMapper
+	Reset()
+}
+
 type DynamicService struct {
 	Client dynamic.Interface
+	// Mapper resolves the resource of a kind, the kind is pluralized when nil
+	Mapper RESTMapper
+}
+
+// ApplyAll applies the resources in the order of SortForApply. CustomResourceDefinitions are waited
+// to be established, and the mapper reset, before applying the resources following them.
+func (s DynamicService) ApplyAll(ctx context.Context, resources []unstructured.Unstructured) error {
+	SortForApply(resources)
+	var pending []unstructured.Unstructured
+	for _, resource := range resources {
+		if len(pending) > 0 && !isCustomResourceDefinition(resource) {
+			err := s.waitForEstablished(ctx, pending)
+			if err != nil {
+				return err
+			}
+			pending = nil
+		}
+		err := s.Apply(ctx, resource)
+		if err != nil {
+			return err
+		}
+		if isCustomResourceDefinition(resource) {
+			pending = append(pending, resource)
+		}
+	}
+	if len(pending) > 0 {
+		return s.waitForEstablished(ctx, pending)
+	}
+	return nil
+}
+
+// Apply server side applies the resource as FieldManager, creating it or updating the live object,
+// and forcing ownership of the fields other managers set
+func (s DynamicService) Apply(ctx context.Context, resource unstructured.Unstructured) error {
+	_, err := s.apply(ctx, resource, false)
+	if err != nil {
+		return fmt.Errorf("error applying %s/%s: %w", resource.GetKind(), resource.GetName(), err)
+	}
+	return nil
 }
 
-func (s DynamicService) Create(resource unstructured.Unstructured) error {
+func (s DynamicService) apply(ctx context.Context, resource unstructured.Unstructured, dryRun bool) (*unstructured.Unstructured, error) {
+	client, err := s.resourceClient(resource)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(resource.Object)
+	if err != nil {
+		return nil, err
+	}
+	options := v1.PatchOptions{FieldManager: FieldManager, Force: pointer.Bool(true)}
+	if dryRun {
+		options.DryRun = []string{v1.DryRunAll}
+	}
+	return client.Patch(ctx, resource.GetName(), types.ApplyPatchType, data, options)
+}
 
-	resSchema := common.GetGroupVersion(resource)
-	alreadyCreatedResource, err := s.GetResource(resource)
-	if err != nil && !errors.IsNotFound(err) {
-		return err
+func (s DynamicService) GetResource(ctx context.Context, resource unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	client, err := s.resourceClient(resource)
+	if err != nil {
+		return nil, err
 	}
-	if alreadyCreatedResource != nil {
-		log.Info(fmt.Sprintf("Resource %s/%s already created", resource.GroupVersionKind(), resource.GetName()))
-		return nil
+	return client.Get(ctx, resource.GetName(), v1.GetOptions{})
+}
+
+// resourceClient returns the client of the resource, namespaced unless its kind is cluster scoped
+func (s DynamicService) resourceClient(resource unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	if s.Mapper == nil {
+		return s.Client.Resource(common.GetGroupVersion(resource)).Namespace(resource.GetNamespace()), nil
 	}
-	_, err = s.Client.Resource(resSchema).Namespace(resource.GetNamespace()).Create(context.TODO(), &resource, v1.CreateOptions{})
+	gvk := resource.GroupVersionKind()
+	mapping, err := s.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("error mapping %s to a resource: %w", gvk, err)
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return s.Client.Resource(mapping.Resource), nil
+	}
+	return s.Client.Resource(mapping.Resource).Namespace(resource.GetNamespace()), nil
+}
+
+// waitForEstablished waits for the CustomResourceDefinitions to serve their kinds, then resets the mapper
+func (s DynamicService) waitForEstablished(ctx context.Context, crds []unstructured.Unstructured) error {
+	ctx, cancel := context.WithTimeout(ctx, establishedTimeout)
+	defer cancel()
+	for _, crd := range crds {
+		err := wait.PollImmediateUntil(establishedPollInterval, func() (bool, error) {
+			current, err := s.Client.Resource(customResourceDefinitions).Get(ctx, crd.GetName(), v1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return isEstablished(*current), nil
+		}, ctx.Done())
+		if err != nil {
+			return fmt.Errorf("error waiting for CustomResourceDefinition %s to be established: %w", crd.GetName(), err)
+		}
+	}
+	if s.Mapper != nil {
+		s.Mapper.Reset()
 	}
 	return nil
 }
 
-func (s DynamicService) GetResource(resource unstructured.Unstructured) (*unstructured.Unstructured, error) {
-	resSchema := common.GetGroupVersion(resource)
-	return s.Client.Resource(resSchema).Namespace(resource.GetNamespace()).Get(context.TODO(), resource.GetName(), v1.GetOptions{})
+func isEstablished(crd unstructured.Unstructured) bool {
+	_, ok := condition(crd, "Established")
+	return ok
 }
@@ -0,0 +1,98 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"testing"
+)
+
+var configMaps = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+type testMapper struct {
+	meta.RESTMapper
+}
+
+func (testMapper) Reset() {}
+
+func newTestService(t *testing.T, objects ...runtime.Object) (DynamicService, *dynamicfake.FakeDynamicClient) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}, meta.RESTScopeNamespace)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		configMaps: "ConfigMapList",
+		jobs:       "JobList",
+	}, objects...)
+	// the fake client does not support server side apply, the reactor applies the patch as a merge
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			t.Fatalf("expected an apply patch, got %s", patch.GetPatchType())
+		}
+		applied := unstructured.Unstructured{}
+		err := json.Unmarshal(patch.GetPatch(), &applied.Object)
+		if err != nil {
+			return true, nil, err
+		}
+		tracker := client.Tracker()
+		current, err := tracker.Get(patch.GetResource(), patch.GetNamespace(), patch.GetName())
+		if err != nil {
+			return true, &applied, tracker.Create(patch.GetResource(), &applied, patch.GetNamespace())
+		}
+		merged := current.(*unstructured.Unstructured).DeepCopy()
+		for key, value := range applied.Object {
+			merged.Object[key] = value
+		}
+		return true, merged, tracker.Update(patch.GetResource(), merged, patch.GetNamespace())
+	})
+	return DynamicService{Client: client, Mapper: testMapper{mapper}}, client
+}
+
+func configMap(value string) *unstructured.Unstructured {
+	resource := &unstructured.Unstructured{}
+	resource.SetAPIVersion("v1")
+	resource.SetKind("ConfigMap")
+	resource.SetNamespace("default")
+	resource.SetName("settings")
+	_ = unstructured.SetNestedField(resource.Object, value, "data", "key")
+	return resource
+}
+
+func TestApplyUpdatesExistingObject(t *testing.T) {
+	service, client := newTestService(t, configMap("old"))
+
+	err := service.ApplyAll(context.Background(), []unstructured.Unstructured{*configMap("new")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	live, err := client.Resource(configMaps).Namespace("default").Get(context.Background(), "settings", v1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	value, _, _ := unstructured.NestedString(live.Object, "data", "key")
+	if value != "new" {
+		t.Errorf("expected the changed manifest to be applied, got data.key %q", value)
+	}
+}
+
+func TestApplyCreatesMissingObject(t *testing.T) {
+	service, client := newTestService(t)
+
+	err := service.Apply(context.Background(), *configMap("value"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err = client.Resource(configMaps).Namespace("default").Get(context.Background(), "settings", v1.GetOptions{})
+	if err != nil {
+		t.Errorf("expected the object to be created: %s", err)
+	}
+}
@@ -0,0 +1,49 @@
+package k8s
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sort"
+)
+
+// applyOrder ranks the kinds other resources rely on, kinds missing from it are applied last
+var applyOrder = map[string]int{
+	"Namespace":                0,
+	"CustomResourceDefinition": 1,
+	"ServiceAccount":           2,
+	"Role":                     2,
+	"ClusterRole":              2,
+	"RoleBinding":              2,
+	"ClusterRoleBinding":       2,
+	"ConfigMap":                3,
+	"Secret":                   3,
+	"Service":                  4,
+	"Pod":                      5,
+	"ReplicationController":    5,
+	"ReplicaSet":               5,
+	"Deployment":               5,
+	"StatefulSet":              5,
+	"DaemonSet":                5,
+	"Job":                      5,
+	"CronJob":                  5,
+}
+
+const otherKindsOrder = 6
+
+// SortForApply orders resources so namespaces, CustomResourceDefinitions, RBAC, configuration and
+// services come before the workloads using them, keeping the rendered order within a kind
+func SortForApply(resources []unstructured.Unstructured) {
+	sort.SliceStable(resources, func(i, j int) bool {
+		return kindOrder(resources[i]) < kindOrder(resources[j])
+	})
+}
+
+func kindOrder(resource unstructured.Unstructured) int {
+	if order, ok := applyOrder[resource.GetKind()]; ok {
+		return order
+	}
+	return otherKindsOrder
+}
+
+func isCustomResourceDefinition(resource unstructured.Unstructured) bool {
+	return resource.GroupVersionKind().Group == customResourceDefinitions.Group && resource.GetKind() == "CustomResourceDefinition"
+}
@@ -0,0 +1,68 @@
+package k8s
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"reflect"
+	"testing"
+)
+
+func resource(kind string, name string) unstructured.Unstructured {
+	object := unstructured.Unstructured{}
+	object.SetKind(kind)
+	object.SetName(name)
+	return object
+}
+
+func TestSortForApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources []unstructured.Unstructured
+		expected  []string
+	}{
+		{
+			name: "dependencies first",
+			resources: []unstructured.Unstructured{
+				resource("Deployment", "app"),
+				resource("Service", "app"),
+				resource("ConfigMap", "settings"),
+				resource("ServiceAccount", "app"),
+				resource("CustomResourceDefinition", "crd"),
+				resource("Namespace", "app"),
+			},
+			expected: []string{"Namespace/app", "CustomResourceDefinition/crd", "ServiceAccount/app", "ConfigMap/settings", "Service/app", "Deployment/app"},
+		},
+		{
+			name: "unknown kinds last",
+			resources: []unstructured.Unstructured{
+				resource("Certificate", "tls"),
+				resource("Job", "migrate"),
+				resource("Secret", "credentials"),
+			},
+			expected: []string{"Secret/credentials", "Job/migrate", "Certificate/tls"},
+		},
+		{
+			name: "rendered order kept within a rank",
+			resources: []unstructured.Unstructured{
+				resource("Secret", "second"),
+				resource("ConfigMap", "first"),
+				resource("Secret", "first"),
+				resource("Role", "reader"),
+				resource("ClusterRoleBinding", "reader"),
+			},
+			expected: []string{"Role/reader", "ClusterRoleBinding/reader", "Secret/second", "ConfigMap/first", "Secret/first"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			SortForApply(test.resources)
+
+			var sorted []string
+			for _, resource := range test.resources {
+				sorted = append(sorted, resource.GetKind()+"/"+resource.GetName())
+			}
+			if !reflect.DeepEqual(sorted, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, sorted)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/common/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SyncWaveAnnotation         = "charlescd.io/sync-wave"
+	HookAnnotation             = "charlescd.io/hook"
+	HookDeletePolicyAnnotation = "charlescd.io/hook-delete-policy"
+)
+
+// Hooks run before the resources, after them, or when the sync fails
+const (
+	HookPreSync  = "PreSync"
+	HookPostSync = "PostSync"
+	HookSyncFail = "SyncFail"
+)
+
+// Delete policies of hooks. Hooks left by a previous sync are always deleted before being created again,
+// BeforeHookCreation being the default.
+const (
+	HookSucceeded      = "HookSucceeded"
+	HookFailed         = "HookFailed"
+	BeforeHookCreation = "BeforeHookCreation"
+)
+
+// healthTimeout is how long the resources of a stage may take to become healthy
+const healthTimeout = 5 * time.Minute
+
+// HookResult is the outcome of a hook run by Sync, Err being nil when it succeeded
+type HookResult struct {
+	Resource   unstructured.Unstructured
+	Hook       string
+	Err        error
+	FinishedAt time.Time
+}
+
+// SyncState is how far a sync went, Sync resuming from it. The zero value starts a new sync.
+type SyncState struct {
+	// Stage is the index of the stage being synced, among the SyncFail stages once Failure is set
+	Stage int
+	// Applied tells whether the resources of the stage were applied, their health being checked
+	Applied bool
+	// StartedAt is when the resources of the stage were applied
+	StartedAt time.Time
+	// Failure is the error the sync failed with, set while the SyncFail hooks run
+	Failure string
+}
+
+// SyncResult is the outcome of a Sync step, Message telling what a sync not Done is waiting for
+type SyncResult struct {
+	State   SyncState
+	Hooks   []HookResult
+	Done    bool
+	Message string
+}
+
+// stage is a wave of resources, or of hooks when hook is set, applied together
+type stage struct {
+	hook      string
+	resources []unstructured.Unstructured
+}
+
+// syncPlan holds the stages of a sync, the PreSync hooks, the resource waves and the PostSync hooks,
+// and the SyncFail stages run when any of them fails
+type syncPlan struct {
+	stages     []stage
+	failStages []stage
+}
+
+// Sync moves the sync of the resources forward from state without waiting. Each stage is applied and then
+// checked until it is healthy, a Job having completed, before the next stage is applied. When the returned
+// result is not Done, Sync is called again later with its State. The error is the one the sync failed with,
+// once the SyncFail hooks ran.
+func (s DynamicService) Sync(ctx context.Context, resources []unstructured.Unstructured, state SyncState) (SyncResult, error) {
+	plan, err := planSync(resources)
+	if err != nil {
+		return SyncResult{Done: true}, err
+	}
+	result := SyncResult{State: state}
+	for {
+		stages := plan.stages
+		if result.State.Failure != "" {
+			stages = plan.failStages
+		}
+		if result.State.Stage >= len(stages) {
+			result.Done = true
+			if result.State.Failure != "" {
+				return result, errors.New(result.State.Failure)
+			}
+			return result, nil
+		}
+		current := stages[result.State.Stage]
+		message, err := s.syncStage(ctx, current, &result)
+		if err != nil && result.State.Failure != "" {
+			log.Error(fmt.Sprintf("Error running SyncFail hooks: %s", err))
+			result.Done = true
+			return result, errors.New(result.State.Failure)
+		}
+		if err != nil {
+			if len(plan.failStages) == 0 {
+				result.Done = true
+				return result, err
+			}
+			result.State = SyncState{Failure: err.Error()}
+			continue
+		}
+		if message != "" {
+			result.Message = message
+			return result, nil
+		}
+		result.State = SyncState{Stage: result.State.Stage + 1, Failure: result.State.Failure}
+	}
+}
+
+// syncStage applies the stage when it was not yet and checks its health once, returning what it waits for
+// while it is not healthy and an error once it failed or timed out
+func (s DynamicService) syncStage(ctx context.Context, current stage, result *SyncResult) (string, error) {
+	if !result.State.Applied {
+		if current.hook != "" {
+			// hooks left by a previous sync are deleted first, a finished Job not running again
+			gone, err := s.deleteHooks(ctx, current.resources)
+			if err != nil {
+				return "", err
+			}
+			if !gone {
+				return fmt.Sprintf("waiting for the previous %s hooks to be deleted", current.hook), nil
+			}
+		}
+		err := s.ApplyAll(ctx, current.resources)
+		if err != nil {
+			return "", err
+		}
+		result.State.Applied = true
+		result.State.StartedAt = time.Now()
+	}
+	var pending []string
+	var failed error
+	healthy := make([]bool, len(current.resources))
+	errs := make([]error, len(current.resources))
+	for i, resource := range current.resources {
+		live, err := s.GetResource(ctx, resource)
+		if err != nil {
+			return "", err
+		}
+		var reason string
+		healthy[i], reason, errs[i] = health(*live)
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("%s/%s is unhealthy: %w", resource.GetKind(), resource.GetName(), errs[i])
+		} else if !healthy[i] && time.Since(result.State.StartedAt) > healthTimeout {
+			errs[i] = fmt.Errorf("%s/%s did not become healthy: %s", resource.GetKind(), resource.GetName(), reason)
+		} else if !healthy[i] {
+			pending = append(pending, fmt.Sprintf("%s/%s: %s", resource.GetKind(), resource.GetName(), reason))
+		}
+		if errs[i] != nil && failed == nil {
+			failed = errs[i]
+		}
+	}
+	if failed == nil && len(pending) > 0 {
+		return strings.Join(pending, ", "), nil
+	}
+	if current.hook != "" {
+		s.finishHooks(ctx, current, errs, result)
+		if failed != nil {
+			return "", fmt.Errorf("%s hook failed: %w", current.hook, failed)
+		}
+	}
+	return "", failed
+}
+
+// finishHooks records the outcome of the hooks of the stage and deletes them per their policy
+func (s DynamicService) finishHooks(ctx context.Context, current stage, errs []error, result *SyncResult) {
+	for i, resource := range current.resources {
+		result.Hooks = append(result.Hooks, HookResult{Resource: resource, Hook: current.hook, Err: errs[i], FinishedAt: time.Now()})
+		policies := deletePolicies(resource)
+		if (errs[i] == nil && policies[HookSucceeded]) || (errs[i] != nil && policies[HookFailed]) {
+			err := s.delete(ctx, resource)
+			if err != nil {
+				log.Error(fmt.Sprintf("Error deleting hook %s/%s: %s", resource.GetKind(), resource.GetName(), err))
+			}
+		}
+	}
+}
+
+func (s DynamicService) delete(ctx context.Context, resource unstructured.Unstructured) error {
+	client, err := s.resourceClient(resource)
+	if err != nil {
+		return err
+	}
+	propagation := v1.DeletePropagationBackground
+	err = client.Delete(ctx, resource.GetName(), v1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// deleteHooks deletes the hooks, telling whether they are all gone
+func (s DynamicService) deleteHooks(ctx context.Context, hooks []unstructured.Unstructured) (bool, error) {
+	gone := true
+	for _, hook := range hooks {
+		err := s.delete(ctx, hook)
+		if isNoMatch(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		_, err = s.GetResource(ctx, hook)
+		if err == nil {
+			gone = false
+		} else if !apierrors.IsNotFound(err) {
+			return false, err
+		}
+	}
+	return gone, nil
+}
+
+func planSync(resources []unstructured.Unstructured) (syncPlan, error) {
+	var main []unstructured.Unstructured
+	hooks := make(map[string][]unstructured.Unstructured)
+	for _, resource := range resources {
+		hook, ok := resource.GetAnnotations()[HookAnnotation]
+		if !ok {
+			main = append(main, resource)
+			continue
+		}
+		switch hook {
+		case HookPreSync, HookPostSync, HookSyncFail:
+			hooks[hook] = append(hooks[hook], resource)
+		default:
+			return syncPlan{}, fmt.Errorf("%s/%s has an unknown %s %q, expected %s, %s or %s", resource.GetKind(), resource.GetName(), HookAnnotation, hook, HookPreSync, HookPostSync, HookSyncFail)
+		}
+	}
+	plan := syncPlan{}
+	for _, phase := range []struct {
+		hook      string
+		resources []unstructured.Unstructured
+	}{
+		{hook: HookPreSync, resources: hooks[HookPreSync]},
+		{resources: main},
+		{hook: HookPostSync, resources: hooks[HookPostSync]},
+	} {
+		waves, err := splitWaves(phase.resources)
+		if err != nil {
+			return syncPlan{}, err
+		}
+		for _, wave := range waves {
+			plan.stages = append(plan.stages, stage{hook: phase.hook, resources: wave})
+		}
+	}
+	waves, err := splitWaves(hooks[HookSyncFail])
+	if err != nil {
+		return syncPlan{}, err
+	}
+	for _, wave := range waves {
+		plan.failStages = append(plan.failStages, stage{hook: HookSyncFail, resources: wave})
+	}
+	return plan, nil
+}
+
+// splitWaves groups the resources by ascending sync wave, resources without wave being in wave 0
+func splitWaves(resources []unstructured.Unstructured) ([][]unstructured.Unstructured, error) {
+	byWave := make(map[int][]unstructured.Unstructured)
+	for _, resource := range resources {
+		wave := 0
+		if value, ok := resource.GetAnnotations()[SyncWaveAnnotation]; ok {
+			var err error
+			wave, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("%s/%s has an invalid %s %q, expected an integer", resource.GetKind(), resource.GetName(), SyncWaveAnnotation, value)
+			}
+		}
+		byWave[wave] = append(byWave[wave], resource)
+	}
+	waves := make([]int, 0, len(byWave))
+	for wave := range byWave {
+		waves = append(waves, wave)
+	}
+	sort.Ints(waves)
+	split := make([][]unstructured.Unstructured, 0, len(waves))
+	for _, wave := range waves {
+		split = append(split, byWave[wave])
+	}
+	return split, nil
+}
+
+func deletePolicies(resource unstructured.Unstructured) map[string]bool {
+	value, ok := resource.GetAnnotations()[HookDeletePolicyAnnotation]
+	if !ok {
+		return map[string]bool{BeforeHookCreation: true}
+	}
+	policies := make(map[string]bool)
+	for _, policy := range strings.Split(value, ",") {
+		policies[strings.TrimSpace(policy)] = true
+	}
+	return policies
+}
@@ -0,0 +1,176 @@
+package k8s
+
+import (
+	"context"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var jobs = schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+
+func job(name string, annotations map[string]string, complete bool) *unstructured.Unstructured {
+	resource := &unstructured.Unstructured{}
+	resource.SetAPIVersion("batch/v1")
+	resource.SetKind("Job")
+	resource.SetNamespace("default")
+	resource.SetName(name)
+	resource.SetAnnotations(annotations)
+	if complete {
+		_ = unstructured.SetNestedSlice(resource.Object, []interface{}{
+			map[string]interface{}{"type": "Complete", "status": "True"},
+		}, "status", "conditions")
+	}
+	return resource
+}
+
+func TestSyncRecreatesFinishedHook(t *testing.T) {
+	hook := map[string]string{HookAnnotation: HookPreSync, HookDeletePolicyAnnotation: HookSucceeded}
+	service, client := newTestService(t, job("migrate", hook, true))
+
+	result, err := service.Sync(context.Background(), []unstructured.Unstructured{*job("migrate", hook, false), *configMap("value")}, SyncState{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Done || result.State.Stage != 0 || !result.State.Applied {
+		t.Fatalf("expected the sync to wait for the new hook, got %+v", result)
+	}
+	if len(result.Hooks) != 0 {
+		t.Errorf("expected the previous hook run not to be reported, got %v", result.Hooks)
+	}
+	deleted := false
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "delete" && action.GetResource() == jobs {
+			deleted = true
+		}
+	}
+	if !deleted {
+		t.Error("expected the finished hook to be deleted before being created again")
+	}
+}
+
+func TestSyncResumesFromState(t *testing.T) {
+	hook := map[string]string{HookAnnotation: HookPreSync, HookDeletePolicyAnnotation: HookSucceeded}
+	service, _ := newTestService(t, job("migrate", hook, true))
+
+	result, err := service.Sync(context.Background(), []unstructured.Unstructured{*job("migrate", hook, false), *configMap("value")}, SyncState{Applied: true, StartedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !result.Done {
+		t.Fatalf("expected the sync to be done, got %+v", result)
+	}
+	if len(result.Hooks) != 1 || result.Hooks[0].Err != nil {
+		t.Errorf("expected the hook to succeed, got %v", result.Hooks)
+	}
+	_, err = service.GetResource(context.Background(), *configMap("value"))
+	if err != nil {
+		t.Errorf("expected the resources to be applied after the hook: %s", err)
+	}
+	_, err = service.GetResource(context.Background(), *job("migrate", nil, false))
+	if err == nil {
+		t.Error("expected the succeeded hook to be deleted")
+	}
+}
+
+func TestSyncTimesOut(t *testing.T) {
+	hook := map[string]string{HookAnnotation: HookPreSync}
+	failHook := map[string]string{HookAnnotation: HookSyncFail}
+	service, _ := newTestService(t, job("migrate", hook, false))
+
+	result, err := service.Sync(context.Background(), []unstructured.Unstructured{*job("migrate", hook, false), *job("notify", failHook, false)}, SyncState{Applied: true, StartedAt: time.Now().Add(-healthTimeout - time.Second)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Done || result.State.Failure == "" || result.State.Stage != 0 || !result.State.Applied {
+		t.Fatalf("expected the SyncFail hook to be applied, got %+v", result)
+	}
+	if len(result.Hooks) != 1 || result.Hooks[0].Err == nil {
+		t.Errorf("expected the hook to time out, got %v", result.Hooks)
+	}
+}
+
+// stageNames describes stages as hook:name,name, the hook being empty for resource waves
+func stageNames(stages []stage) []string {
+	var names []string
+	for _, stage := range stages {
+		var resources []string
+		for _, resource := range stage.resources {
+			resources = append(resources, resource.GetName())
+		}
+		names = append(names, stage.hook+":"+strings.Join(resources, ","))
+	}
+	return names
+}
+
+func TestPlanSync(t *testing.T) {
+	tests := []struct {
+		name       string
+		resources  []unstructured.Unstructured
+		stages     []string
+		failStages []string
+		err        bool
+	}{
+		{
+			name:      "single wave",
+			resources: []unstructured.Unstructured{*job("first", nil, false), *job("second", nil, false)},
+			stages:    []string{":first,second"},
+		},
+		{
+			name: "waves in numeric order",
+			resources: []unstructured.Unstructured{
+				*job("late", map[string]string{SyncWaveAnnotation: "10"}, false),
+				*job("default", nil, false),
+				*job("early", map[string]string{SyncWaveAnnotation: "-1"}, false),
+				*job("second", map[string]string{SyncWaveAnnotation: " 2 "}, false),
+			},
+			stages: []string{":early", ":default", ":second", ":late"},
+		},
+		{
+			name: "hook phases",
+			resources: []unstructured.Unstructured{
+				*job("notify", map[string]string{HookAnnotation: HookPostSync}, false),
+				*job("app", nil, false),
+				*job("cleanup", map[string]string{HookAnnotation: HookSyncFail}, false),
+				*job("migrate", map[string]string{HookAnnotation: HookPreSync, SyncWaveAnnotation: "1"}, false),
+				*job("backup", map[string]string{HookAnnotation: HookPreSync}, false),
+			},
+			stages:     []string{"PreSync:backup", "PreSync:migrate", ":app", "PostSync:notify"},
+			failStages: []string{"SyncFail:cleanup"},
+		},
+		{
+			name:      "unknown hook",
+			resources: []unstructured.Unstructured{*job("migrate", map[string]string{HookAnnotation: "PreDelete"}, false)},
+			err:       true,
+		},
+		{
+			name:      "invalid wave",
+			resources: []unstructured.Unstructured{*job("migrate", map[string]string{SyncWaveAnnotation: "first"}, false)},
+			err:       true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan, err := planSync(test.resources)
+
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if stages := stageNames(plan.stages); !reflect.DeepEqual(stages, test.stages) {
+				t.Errorf("expected stages %v, got %v", test.stages, stages)
+			}
+			if failStages := stageNames(plan.failStages); !reflect.DeepEqual(failStages, test.failStages) {
+				t.Errorf("expected fail stages %v, got %v", test.failStages, failStages)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package kustomize
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+	"sort"
+	"strings"
+)
+
+// kustomizeGroup is the API group of kustomization and component files
+const kustomizeGroup = "kustomize.config.k8s.io/"
+
+// renderedManifests is where the output of other renderers is written to be built as a kustomization
+const renderedManifests = "/.charles-rendered/manifests.yaml"
+
+var manifestExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// DirectoryOptions select the manifests of a directory without kustomization
+type DirectoryOptions struct {
+	Recursive bool
+	Include   []string
+	Exclude   []string
+}
+
+// Prepare returns the kustomization root to render for chart. A directory holding a kustomization
+// is returned as is, otherwise a kustomization listing the plain manifests selected by options,
+// or the single manifest chart points to, is generated in fsys
+func Prepare(fsys filesys.FileSystem, chart string, options DirectoryOptions) (string, error) {
+	if !fsys.Exists(chart) {
+		return "", fmt.Errorf("%s does not exist in the source", chart)
+	}
+	if !fsys.IsDir(chart) {
+		dir := filepath.Dir(chart)
+		if hasKustomization(fsys, dir) {
+			return "", fmt.Errorf("%s is a manifest of a directory holding a kustomization, use the directory instead", chart)
+		}
+		return dir, writeKustomization(fsys, dir, []string{filepath.Base(chart)})
+	}
+	if hasKustomization(fsys, chart) {
+		return chart, nil
+	}
+	for _, pattern := range append(append([]string{}, options.Include...), options.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return "", fmt.Errorf("invalid glob %s: %w", pattern, err)
+		}
+	}
+	manifests, err := listManifests(fsys, chart, options)
+	if err != nil {
+		return "", err
+	}
+	if len(manifests) == 0 {
+		return "", fmt.Errorf("%s holds neither a kustomization nor manifests", chart)
+	}
+	return chart, writeKustomization(fsys, chart, manifests)
+}
+
+// WriteManifests writes the manifests of another renderer to fsys, returning the chart to Prepare
+func WriteManifests(fsys filesys.FileSystem, manifests []byte) (string, error) {
+	err := fsys.MkdirAll(filepath.Dir(renderedManifests))
+	if err != nil {
+		return "", err
+	}
+	return renderedManifests, fsys.WriteFile(renderedManifests, manifests)
+}
+
+func hasKustomization(fsys filesys.FileSystem, dir string) bool {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if fsys.Exists(filepath.Join(dir, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// listManifests returns the paths relative to dir of the manifests selected by options, sorted.
+// Files that are not Kubernetes objects, as kustomization files, are skipped, as well as the nested
+// directories holding a kustomization, which are roots of their own.
+func listManifests(fsys filesys.FileSystem, dir string, options DirectoryOptions) ([]string, error) {
+	var manifests []string
+	err := fsys.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && (!options.Recursive || hasKustomization(fsys, path)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !manifestExtensions[filepath.Ext(path)] {
+			return nil
+		}
+		if len(options.Include) > 0 && !matchAny(options.Include, relativePath) {
+			return nil
+		}
+		if matchAny(options.Exclude, relativePath) {
+			return nil
+		}
+		if !isManifest(fsys, path) {
+			return nil
+		}
+		manifests = append(manifests, relativePath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(manifests)
+	return manifests, nil
+}
+
+// isManifest tells whether every document of the file is a Kubernetes object other than a kustomization
+func isManifest(fsys filesys.FileSystem, path string) bool {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if filepath.Base(path) == name {
+			return false
+		}
+	}
+	content, err := fsys.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	nodes, err := kio.FromBytes(content)
+	if err != nil || len(nodes) == 0 {
+		return false
+	}
+	for _, node := range nodes {
+		if node.GetApiVersion() == "" || node.GetKind() == "" || strings.HasPrefix(node.GetApiVersion(), kustomizeGroup) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny tells whether a glob matches the relative path or its file name
+func matchAny(patterns []string, relativePath string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, relativePath); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, filepath.Base(relativePath)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func writeKustomization(fsys filesys.FileSystem, dir string, resources []string) error {
+	kustomization := types.Kustomization{
+		TypeMeta: types.TypeMeta{
+			APIVersion: types.KustomizationVersion,
+			Kind:       types.KustomizationKind,
+		},
+		Resources: resources,
+	}
+	content, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return fmt.Errorf("error generating the kustomization of %s: %w", dir, err)
+	}
+	return fsys.WriteFile(filepath.Join(dir, konfig.DefaultKustomizationFileName()), content)
+}
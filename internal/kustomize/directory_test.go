@@ -0,0 +1,72 @@
+package kustomize
+
+import (
+	"reflect"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"testing"
+)
+
+func TestListManifests(t *testing.T) {
+	fsys := filesys.MakeFsInMemory()
+	_ = fsys.WriteFile("/app/configmap.yaml", []byte(configMapManifest))
+	_ = fsys.WriteFile("/app/list.yaml", []byte(configMapManifest+"---\n"+configMapManifest))
+	_ = fsys.WriteFile("/app/service.json", []byte(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"app"}}`))
+	_ = fsys.WriteFile("/app/values.yaml", []byte("replicas: 2\n"))
+	_ = fsys.WriteFile("/app/mixed.yaml", []byte(configMapManifest+"---\nreplicas: 2\n"))
+	_ = fsys.WriteFile("/app/README.md", []byte("# app\n"))
+	_ = fsys.WriteFile("/app/nested/deployment.yml", []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n"))
+	_ = fsys.WriteFile("/app/nested/component.yaml", []byte("apiVersion: kustomize.config.k8s.io/v1alpha1\nkind: Component\n"))
+	_ = fsys.WriteFile("/app/overlay/kustomization.yaml", []byte("resources:\n- configmap.yaml\n"))
+	_ = fsys.WriteFile("/app/overlay/configmap.yaml", []byte(configMapManifest))
+
+	tests := []struct {
+		name     string
+		options  DirectoryOptions
+		expected []string
+	}{
+		{
+			name:     "top level",
+			expected: []string{"configmap.yaml", "list.yaml", "service.json"},
+		},
+		{
+			name:     "recursive",
+			options:  DirectoryOptions{Recursive: true},
+			expected: []string{"configmap.yaml", "list.yaml", "nested/deployment.yml", "service.json"},
+		},
+		{
+			name:     "include and exclude",
+			options:  DirectoryOptions{Recursive: true, Include: []string{"*.yaml", "*.yml"}, Exclude: []string{"list.yaml"}},
+			expected: []string{"configmap.yaml", "nested/deployment.yml"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manifests, err := listManifests(fsys, "/app", test.options)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(manifests, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, manifests)
+			}
+		})
+	}
+}
+
+func TestPrepareGeneratesKustomization(t *testing.T) {
+	fsys := filesys.MakeFsInMemory()
+	_ = fsys.WriteFile("/app/configmap.yaml", []byte(configMapManifest))
+	_ = fsys.WriteFile("/app/values.yaml", []byte("replicas: 2\n"))
+
+	chart, err := Prepare(fsys, "/app", DirectoryOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resources, err := New(fsys, Options{}).RenderManifests(chart)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if resources.Size() != 1 || resources.Resources()[0].GetName() != "settings" {
+		t.Errorf("expected only the ConfigMap to be rendered, got %v", resources.Resources())
+	}
+}
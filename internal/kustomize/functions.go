@@ -0,0 +1,70 @@
+package kustomize
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/fn/runtime/runtimeutil"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+)
+
+// ValidateFunctions checks every KRM function plugin declared in fsys against the options,
+// so a source cannot run an image or executable the operator did not allow
+func ValidateFunctions(fsys filesys.FileSystem, options Options) error {
+	allowed := make(map[string]bool, len(options.AllowedFunctions))
+	for _, function := range options.AllowedFunctions {
+		allowed[function] = true
+	}
+	return fsys.Walk(string(filepath.Separator), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		extension := filepath.Ext(path)
+		if info.IsDir() || (extension != ".yaml" && extension != ".yml") {
+			return nil
+		}
+		content, err := fsys.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		nodes, err := kio.FromBytes(content)
+		if err != nil {
+			// files kustomize does not load may not be valid yaml, those it loads fail the render instead
+			return nil
+		}
+		for _, node := range nodes {
+			spec := runtimeutil.GetFunctionSpec(node)
+			if spec == nil {
+				continue
+			}
+			err = validateFunction(path, *spec, options, allowed)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func validateFunction(path string, spec runtimeutil.FunctionSpec, options Options, allowed map[string]bool) error {
+	if !options.EnableAlphaPlugins {
+		return fmt.Errorf("%s declares a function plugin but alpha plugins are not enabled", path)
+	}
+	switch {
+	case spec.Exec.Path != "":
+		if !options.EnableExec {
+			return fmt.Errorf("%s declares exec function %s but exec plugins are not enabled", path, spec.Exec.Path)
+		}
+		if !allowed[spec.Exec.Path] {
+			return fmt.Errorf("%s declares exec function %s which is not allowed", path, spec.Exec.Path)
+		}
+	case spec.Container.Image != "":
+		if !allowed[spec.Container.Image] {
+			return fmt.Errorf("%s declares function image %s which is not allowed", path, spec.Container.Image)
+		}
+	default:
+		return fmt.Errorf("%s declares an unsupported function plugin", path)
+	}
+	return nil
+}
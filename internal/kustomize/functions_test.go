@@ -0,0 +1,80 @@
+package kustomize
+
+import (
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"testing"
+)
+
+// functionManifest declares a function plugin through the config.kubernetes.io/function annotation
+func functionManifest(spec string) string {
+	return `apiVersion: example.com/v1
+kind: Generator
+metadata:
+  name: generator
+  annotations:
+    config.kubernetes.io/function: |
+      ` + spec + "\n"
+}
+
+func TestValidateFunctions(t *testing.T) {
+	allowed := []string{"example.com/fn:v1", "/usr/bin/fn"}
+	tests := []struct {
+		name     string
+		manifest string
+		options  Options
+		err      bool
+	}{
+		{
+			name:     "no function",
+			manifest: configMapManifest,
+		},
+		{
+			name:     "alpha plugins disabled",
+			manifest: functionManifest("container: {image: example.com/fn:v1}"),
+			options:  Options{AllowedFunctions: allowed},
+			err:      true,
+		},
+		{
+			name:     "allowed image",
+			manifest: functionManifest("container: {image: example.com/fn:v1}"),
+			options:  Options{EnableAlphaPlugins: true, AllowedFunctions: allowed},
+		},
+		{
+			name:     "image not allowed",
+			manifest: functionManifest("container: {image: example.com/other:v1}"),
+			options:  Options{EnableAlphaPlugins: true, AllowedFunctions: allowed},
+			err:      true,
+		},
+		{
+			name:     "exec disabled",
+			manifest: functionManifest("exec: {path: /usr/bin/fn}"),
+			options:  Options{EnableAlphaPlugins: true, AllowedFunctions: allowed},
+			err:      true,
+		},
+		{
+			name:     "allowed exec",
+			manifest: functionManifest("exec: {path: /usr/bin/fn}"),
+			options:  Options{EnableAlphaPlugins: true, EnableExec: true, AllowedFunctions: allowed},
+		},
+		{
+			name:     "exec not allowed",
+			manifest: functionManifest("exec: {path: /bin/sh}"),
+			options:  Options{EnableAlphaPlugins: true, EnableExec: true, AllowedFunctions: allowed},
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := filesys.MakeFsInMemory()
+			_ = fsys.WriteFile("/app/kustomization.yaml", []byte("generators:\n- generator.yaml\n"))
+			_ = fsys.WriteFile("/app/generator.yaml", []byte(test.manifest))
+			_ = fsys.WriteFile("/app/notes.yaml", []byte("{ not yaml"))
+
+			err := ValidateFunctions(fsys, test.options)
+
+			if test.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -2,30 +2,229 @@ package kustomize
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sigs.k8s.io/kustomize/api/krusty"
 	"sigs.k8s.io/kustomize/api/resmap"
-	"sigs.k8s.io/kustomize/kustomize/v4/commands/build"
+	"sigs.k8s.io/kustomize/api/types"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"strings"
 )
 
 type KustomizeWrapper struct {
 	Kustomizer *krusty.Kustomizer
 	Filesys    filesys.FileSystem
+	// onDisk renders from a copy of Filesys written to a temporary directory, as helm reads and
+	// pulls charts on the real filesystem
+	onDisk bool
+}
+
+const (
+	// ReorderLegacy sorts the rendered resources by kind, as kustomize build does by default
+	ReorderLegacy = "legacy"
+	// ReorderNone keeps the resources in the order of the kustomization
+	ReorderNone = "none"
+)
+
+// Options configure every render made by a KustomizeWrapper
+type Options struct {
+	// LoadRestrictions limits the files a kustomization may load, the kustomize default applies when unknown
+	LoadRestrictions types.LoadRestrictions
+	// EnableHelm inflates helmCharts with the HelmCommand binary, which renders on the operator disk and
+	// requires AllowHelm, set by the operator only, and the root only load restrictions
+	EnableHelm  bool
+	AllowHelm   bool
+	HelmCommand string
+	// EnableAlphaPlugins runs KRM function plugins, EnableExec also allows those run as executables
+	EnableAlphaPlugins bool
+	EnableExec         bool
+	// AllowedFunctions are the container images and executable paths KRM function plugins may use
+	AllowedFunctions []string
+	// Reorder is ReorderLegacy or ReorderNone, resources keep their order when empty
+	Reorder string
+}
+
+// Validate rejects options kustomize would misbehave with
+func (o Options) Validate() error {
+	switch o.Reorder {
+	case "", ReorderLegacy, ReorderNone:
+	default:
+		return fmt.Errorf("unknown reorder %s, expected %s or %s", o.Reorder, ReorderLegacy, ReorderNone)
+	}
+	if o.EnableExec && !o.EnableAlphaPlugins {
+		return fmt.Errorf("exec plugins require alpha plugins to be enabled")
+	}
+	if o.EnableAlphaPlugins && len(o.AllowedFunctions) == 0 {
+		return fmt.Errorf("alpha plugins are enabled but the operator allows no function")
+	}
+	if o.EnableHelm && !o.AllowHelm {
+		return fmt.Errorf("helm is enabled but the operator does not allow it")
+	}
+	if o.EnableHelm && o.HelmCommand == "" {
+		return fmt.Errorf("helm is enabled but no helm command is configured")
+	}
+	if o.EnableHelm && o.LoadRestrictions == types.LoadRestrictionsNone {
+		return fmt.Errorf("helm renders on the operator disk, which requires %s", types.LoadRestrictionsRootOnly)
+	}
+	return nil
+}
+
+func (o Options) krustyOptions() *krusty.Options {
+	kustomizeOptions := krusty.MakeDefaultOptions()
+	if o.LoadRestrictions != types.LoadRestrictionsUnknown {
+		kustomizeOptions.LoadRestrictions = o.LoadRestrictions
+	}
+	if o.EnableAlphaPlugins {
+		kustomizeOptions.PluginConfig = types.EnabledPluginConfig(types.BploUseStaticallyLinked)
+		kustomizeOptions.PluginConfig.FnpLoadingOptions.EnableExec = o.EnableExec
+	}
+	if o.EnableHelm {
+		// kustomizations loading files outside their root would read the operator disk
+		kustomizeOptions.LoadRestrictions = types.LoadRestrictionsRootOnly
+	}
+	kustomizeOptions.PluginConfig.HelmConfig.Enabled = o.EnableHelm
+	kustomizeOptions.PluginConfig.HelmConfig.Command = o.HelmCommand
+	kustomizeOptions.DoLegacyResourceSort = o.Reorder == ReorderLegacy
+	return kustomizeOptions
 }
 
 func (w KustomizeWrapper) RenderManifests(chart string) (resmap.ResMap, error) {
-	response, err := w.Kustomizer.Run(w.Filesys, chart)
+	fsys := w.Filesys
+	if w.onDisk {
+		dir, err := ioutil.TempDir("", "charles-render")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		err = writeToDisk(w.Filesys, dir)
+		if err != nil {
+			return nil, fmt.Errorf("error writing the source to disk for helm: %w", err)
+		}
+		fsys = filesys.MakeFsOnDisk()
+		chart = filepath.Join(dir, chart)
+	}
+	response, err := w.Kustomizer.Run(fsys, chart)
 	if err != nil {
 		return nil, fmt.Errorf("error running build of kustomize:  %w", err)
 	}
 	return response, nil
 }
 
-func New() KustomizeWrapper {
-	fsys := filesys.MakeFsOnDisk()
+// New creates a wrapper rendering kustomizations from fsys, usually an in-memory
+// copy of the fetched source made by LoadFs so renders cannot read the operator disk.
+// With helm enabled, renders run on a temporary copy of fsys on disk instead.
+func New(fsys filesys.FileSystem, options Options) KustomizeWrapper {
+	kustomize := krusty.MakeKustomizer(options.krustyOptions())
+	return KustomizeWrapper{Kustomizer: kustomize, Filesys: fsys, onDisk: options.EnableHelm}
+}
+
+// writeToDisk copies the files of fsys, rooted at /, under dir
+func writeToDisk(fsys filesys.FileSystem, dir string) error {
+	return fsys.Walk(string(filepath.Separator), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		diskPath := filepath.Join(dir, path)
+		if info.IsDir() {
+			return os.MkdirAll(diskPath, 0755)
+		}
+		content, err := fsys.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(diskPath, content, 0644)
+	})
+}
 
-	kustomize := krusty.MakeKustomizer(
-		build.HonorKustomizeFlags(krusty.MakeDefaultOptions()),
-	)
-	return KustomizeWrapper{Kustomizer: kustomize, Filesys: fsys}
+// LoadFs copies the files under dir into an in-memory filesystem rooted at /. Symlinks are
+// resolved, those to directories being copied recursively, and refused when they point outside dir.
+func LoadFs(dir string) (filesys.FileSystem, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	fsys := filesys.MakeFsInMemory()
+	err = copyDir(fsys, root, root, string(filepath.Separator), make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// copyDir copies the directory diskPath of root to memoryPath of fsys. ancestors are the directories
+// being copied, a symlink pointing back to one of them being a loop.
+func copyDir(fsys filesys.FileSystem, root string, diskPath string, memoryPath string, ancestors map[string]bool) error {
+	if ancestors[diskPath] {
+		return fmt.Errorf("symlink loop at %s", memoryPath)
+	}
+	ancestors[diskPath] = true
+	defer delete(ancestors, diskPath)
+	err := fsys.MkdirAll(memoryPath)
+	if err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(diskPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entryPath := filepath.Join(diskPath, entry.Name())
+		entryMemoryPath := filepath.Join(memoryPath, entry.Name())
+		if entry.Mode()&os.ModeSymlink != 0 {
+			entryPath, err = resolveSymlink(root, entryPath)
+			if err != nil {
+				return err
+			}
+			entry, err = os.Stat(entryPath)
+			if err != nil {
+				return err
+			}
+		}
+		if entry.IsDir() {
+			err = copyDir(fsys, root, entryPath, entryMemoryPath, ancestors)
+		} else {
+			err = copyFile(fsys, entryPath, entryMemoryPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(fsys filesys.FileSystem, diskPath string, memoryPath string) error {
+	content, err := ioutil.ReadFile(diskPath)
+	if err != nil {
+		return err
+	}
+	return fsys.WriteFile(memoryPath, content)
+}
+
+// resolveSymlink returns the final target of the symlink at path, refusing targets outside root
+func resolveSymlink(root string, path string) (string, error) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("error resolving symlink %s: %w", path, err)
+	}
+	if target != root && !strings.HasPrefix(target, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("symlink %s points outside of %s", path, root)
+	}
+	return target, nil
+}
+
+// ParseLoadRestrictions parses the kustomize --load-restrictor values
+func ParseLoadRestrictions(value string) (types.LoadRestrictions, error) {
+	switch value {
+	case types.LoadRestrictionsRootOnly.String(), "rootOnly":
+		return types.LoadRestrictionsRootOnly, nil
+	case types.LoadRestrictionsNone.String(), "none":
+		return types.LoadRestrictionsNone, nil
+	default:
+		return types.LoadRestrictionsUnknown, fmt.Errorf("unknown load restrictor %s", value)
+	}
 }
@@ -0,0 +1,135 @@
+package kustomize
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"testing"
+)
+
+const configMapManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  key: value
+`
+
+func TestRenderManifestsWithHelmRendersOnDisk(t *testing.T) {
+	fsys := filesys.MakeFsInMemory()
+	_ = fsys.WriteFile("/app/kustomization.yaml", []byte("resources:\n- configmap.yaml\n"))
+	_ = fsys.WriteFile("/app/configmap.yaml", []byte(configMapManifest))
+
+	for _, enableHelm := range []bool{false, true} {
+		wrapper := New(fsys, Options{EnableHelm: enableHelm, HelmCommand: "helm"})
+		resources, err := wrapper.RenderManifests("/app")
+		if err != nil {
+			t.Fatalf("unexpected error with helm enabled %t: %s", enableHelm, err)
+		}
+		if resources.Size() != 1 || resources.Resources()[0].GetName() != "settings" {
+			t.Errorf("expected the ConfigMap to be rendered with helm enabled %t, got %v", enableHelm, resources.Resources())
+		}
+	}
+}
+
+func TestLoadFsResolvesSymlinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		links    map[string]string
+		expected []string
+		err      bool
+	}{
+		{
+			name:     "link to a file",
+			links:    map[string]string{"app/configmap.yaml": "../base/configmap.yaml"},
+			expected: []string{"/app/configmap.yaml", "/base/configmap.yaml"},
+		},
+		{
+			name:     "link to a directory",
+			links:    map[string]string{"app/base": "../base"},
+			expected: []string{"/app/base/configmap.yaml", "/base/configmap.yaml"},
+		},
+		{
+			name:  "link outside of the root",
+			links: map[string]string{"app/outside": "../.."},
+			err:   true,
+		},
+		{
+			name:  "link loop",
+			links: map[string]string{"base/loop": ".."},
+			err:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "source")
+			_ = os.MkdirAll(filepath.Join(dir, "app"), 0755)
+			_ = os.MkdirAll(filepath.Join(dir, "base"), 0755)
+			_ = ioutil.WriteFile(filepath.Join(dir, "base", "configmap.yaml"), []byte(configMapManifest), 0644)
+			for link, target := range test.links {
+				if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+
+			fsys, err := LoadFs(dir)
+
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, path := range test.expected {
+				content, err := fsys.ReadFile(path)
+				if err != nil || string(content) != configMapManifest {
+					t.Errorf("expected %s to hold the manifest, got %q: %v", path, content, err)
+				}
+			}
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		err     bool
+	}{
+		{name: "defaults", options: Options{}},
+		{name: "helm allowed", options: Options{EnableHelm: true, AllowHelm: true, HelmCommand: "helm"}},
+		{name: "helm not allowed", options: Options{EnableHelm: true, HelmCommand: "helm"}, err: true},
+		{name: "helm without command", options: Options{EnableHelm: true, AllowHelm: true}, err: true},
+		{name: "helm without load restrictions", options: Options{EnableHelm: true, AllowHelm: true, HelmCommand: "helm", LoadRestrictions: types.LoadRestrictionsNone}, err: true},
+		{name: "exec without alpha plugins", options: Options{EnableExec: true, AllowedFunctions: []string{"/bin/fn"}}, err: true},
+		{name: "alpha plugins without allowed functions", options: Options{EnableAlphaPlugins: true}, err: true},
+		{name: "unknown reorder", options: Options{Reorder: "alphabetical"}, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.options.Validate()
+			if test.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestRenderManifestsWithHelmOnlyLoadsUnderRoot(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "hostname")
+	_ = ioutil.WriteFile(outside, []byte("operator-host"), 0644)
+	fsys := filesys.MakeFsInMemory()
+	_ = fsys.WriteFile("/app/kustomization.yaml", []byte("configMapGenerator:\n- name: leak\n  files:\n  - "+outside+"\n"))
+
+	wrapper := New(fsys, Options{EnableHelm: true, AllowHelm: true, HelmCommand: "helm", LoadRestrictions: types.LoadRestrictionsNone})
+	resources, err := wrapper.RenderManifests("/app")
+
+	if err == nil {
+		t.Errorf("expected loading a file outside the root to fail, got %v", resources.Resources())
+	}
+}
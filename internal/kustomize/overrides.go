@@ -0,0 +1,69 @@
+package kustomize
+
+import (
+	"fmt"
+	"path/filepath"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// overridesDir holds the generated wrapper kustomization, outside of any directory a source is likely to use
+const overridesDir = "/.charles-overrides"
+
+// Overrides are applied on top of a kustomization without committing a new overlay
+type Overrides struct {
+	Patches           []types.Patch
+	CommonLabels      map[string]string
+	CommonAnnotations map[string]string
+	NamePrefix        string
+	NameSuffix        string
+	Replicas          []types.Replica
+	Images            []types.Image
+}
+
+func (o Overrides) IsEmpty() bool {
+	return len(o.Patches) == 0 && len(o.CommonLabels) == 0 && len(o.CommonAnnotations) == 0 &&
+		o.NamePrefix == "" && o.NameSuffix == "" && len(o.Replicas) == 0 && len(o.Images) == 0
+}
+
+// Wrap writes a kustomization to fsys using chart as its only resource and applying the
+// overrides, returning the path to render instead of chart. chart is returned when there
+// is nothing to override.
+func Wrap(fsys filesys.FileSystem, chart string, overrides Overrides) (string, error) {
+	if overrides.IsEmpty() {
+		return chart, nil
+	}
+	resource, err := filepath.Rel(overridesDir, chart)
+	if err != nil {
+		return "", err
+	}
+	kustomization := types.Kustomization{
+		TypeMeta: types.TypeMeta{
+			APIVersion: types.KustomizationVersion,
+			Kind:       types.KustomizationKind,
+		},
+		Resources:         []string{resource},
+		Patches:           overrides.Patches,
+		CommonLabels:      overrides.CommonLabels,
+		CommonAnnotations: overrides.CommonAnnotations,
+		NamePrefix:        overrides.NamePrefix,
+		NameSuffix:        overrides.NameSuffix,
+		Replicas:          overrides.Replicas,
+		Images:            overrides.Images,
+	}
+	content, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return "", fmt.Errorf("error generating the overrides kustomization: %w", err)
+	}
+	err = fsys.MkdirAll(overridesDir)
+	if err != nil {
+		return "", err
+	}
+	err = fsys.WriteFile(filepath.Join(overridesDir, konfig.DefaultKustomizationFileName()), content)
+	if err != nil {
+		return "", err
+	}
+	return overridesDir, nil
+}
@@ -0,0 +1,149 @@
+package kustomize
+
+import (
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/yaml"
+	"strings"
+	"testing"
+)
+
+const deploymentManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: app
+        image: nginx:1.0
+`
+
+func TestWrapAppliesOverrides(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides Overrides
+		expected  []string
+	}{
+		{
+			name:      "name prefix and suffix",
+			overrides: Overrides{NamePrefix: "dev-", NameSuffix: "-v2"},
+			expected:  []string{"name: dev-app-v2", "name: dev-settings-v2"},
+		},
+		{
+			name:      "common labels and annotations",
+			overrides: Overrides{CommonLabels: map[string]string{"team": "core"}, CommonAnnotations: map[string]string{"owner": "core"}},
+			expected:  []string{"team: core", "owner: core"},
+		},
+		{
+			name:      "images",
+			overrides: Overrides{Images: []types.Image{{Name: "nginx", NewName: "registry.example.com/nginx", NewTag: "2.0"}}},
+			expected:  []string{"image: registry.example.com/nginx:2.0"},
+		},
+		{
+			name:      "replicas",
+			overrides: Overrides{Replicas: []types.Replica{{Name: "app", Count: 3}}},
+			expected:  []string{"replicas: 3"},
+		},
+		{
+			name: "strategic merge patch",
+			overrides: Overrides{Patches: []types.Patch{{Patch: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        env:
+        - name: LOG_LEVEL
+          value: debug
+`}}},
+			expected: []string{"name: LOG_LEVEL", "value: debug", "image: nginx:1.0"},
+		},
+		{
+			name: "json6902 patch",
+			overrides: Overrides{Patches: []types.Patch{{
+				Patch:  `[{"op": "replace", "path": "/data/key", "value": "patched"}]`,
+				Target: &types.Selector{ResId: resid.ResId{Gvk: resid.Gvk{Kind: "ConfigMap"}, Name: "settings"}},
+			}}},
+			expected: []string{"key: patched"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := filesys.MakeFsInMemory()
+			_ = fsys.WriteFile("/app/deployment.yaml", []byte(deploymentManifest))
+			_ = fsys.WriteFile("/app/configmap.yaml", []byte(configMapManifest))
+
+			chart, err := Prepare(fsys, "/app", DirectoryOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			chart, err = Wrap(fsys, chart, test.overrides)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			resources, err := New(fsys, Options{}).RenderManifests(chart)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			manifests, err := resources.AsYaml()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			for _, expected := range test.expected {
+				if !strings.Contains(string(manifests), expected) {
+					t.Errorf("expected %q in the manifests, got\n%s", expected, manifests)
+				}
+			}
+		})
+	}
+}
+
+func TestWrapWithoutOverridesKeepsChart(t *testing.T) {
+	fsys := filesys.MakeFsInMemory()
+
+	chart, err := Wrap(fsys, "/app", Overrides{})
+
+	if err != nil || chart != "/app" {
+		t.Errorf("expected the chart to be rendered as is, got %s: %v", chart, err)
+	}
+	if fsys.Exists(overridesDir) {
+		t.Errorf("expected no overrides kustomization to be written")
+	}
+}
+
+func TestWrapRendersKustomizations(t *testing.T) {
+	fsys := filesys.MakeFsInMemory()
+	_ = fsys.WriteFile("/base/kustomization.yaml", []byte("resources:\n- configmap.yaml\n"))
+	_ = fsys.WriteFile("/base/configmap.yaml", []byte(configMapManifest))
+	_ = fsys.WriteFile("/overlays/dev/kustomization.yaml", []byte("resources:\n- ../../base\nnameSuffix: -dev\n"))
+
+	chart, err := Wrap(fsys, "/overlays/dev", Overrides{NamePrefix: "team-"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resources, err := New(fsys, Options{}).RenderManifests(chart)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var names []string
+	for _, resource := range resources.Resources() {
+		names = append(names, resource.GetName())
+	}
+	if len(names) != 1 || names[0] != "team-settings-dev" {
+		t.Errorf("expected the overlay and the overrides to be applied, got %v", names)
+	}
+	content, _ := fsys.ReadFile(overridesDir + "/kustomization.yaml")
+	kustomization := types.Kustomization{}
+	if err := yaml.Unmarshal(content, &kustomization); err != nil || len(kustomization.Resources) != 1 || kustomization.Resources[0] != "../overlays/dev" {
+		t.Errorf("expected the overrides kustomization to refer to the chart, got %s: %v", content, err)
+	}
+}
@@ -0,0 +1,53 @@
+// Package options holds the options components are rendered with, shared by the operator and
+// kubectl-charles so both render a component the same way
+package options
+
+import (
+	"flag"
+	"fmt"
+	"github.com/thalleslmF/go-operator/internal/kustomize"
+	"github.com/thalleslmF/go-operator/internal/repository"
+	"strings"
+	"time"
+)
+
+// Render are the source download and kustomize options, set from their flags by BindFlags and Complete
+type Render struct {
+	Repository repository.Options
+	Kustomize  kustomize.Options
+
+	loadRestrictor   string
+	allowedFunctions string
+}
+
+// BindFlags registers the source and kustomize flags, with the defaults of the operator
+func (r *Render) BindFlags(flags *flag.FlagSet) {
+	flags.Int64Var(&r.Repository.MaxFileSize, "source-max-file-size", 10<<20, "The size in bytes above which a file of a component source is not downloaded. Zero means no limit.")
+	flags.Int64Var(&r.Repository.MaxTotalSize, "source-max-total-size", 100<<20, "The size in bytes above which a component source is not downloaded. Zero means no limit.")
+	flags.IntVar(&r.Repository.Workers, "source-download-workers", 4, "The number of files of a component source downloaded in parallel.")
+	flags.DurationVar(&r.Repository.RequestTimeout, "source-request-timeout", 30*time.Second, "The timeout of each request made to a source provider.")
+	flags.IntVar(&r.Repository.Retries, "source-request-retries", 3, "The number of times a source provider request failing with a network or server error is retried.")
+	flags.StringVar(&r.loadRestrictor, "kustomize-load-restrictor", "LoadRestrictionsRootOnly", "Whether kustomizations may load files outside their root, either LoadRestrictionsRootOnly or LoadRestrictionsNone.")
+	flags.BoolVar(&r.Kustomize.AllowHelm, "kustomize-allow-helm", false, "Whether components may enable helm, which renders their kustomization on the operator disk.")
+	flags.StringVar(&r.Kustomize.HelmCommand, "kustomize-helm-command", "helm", "The helm binary components enabling helm use to inflate charts.")
+	flags.StringVar(&r.Kustomize.Reorder, "kustomize-reorder", "", "The default order of rendered resources, either legacy to sort them by kind or none.")
+	flags.StringVar(&r.allowedFunctions, "kustomize-allowed-functions", "", "Comma separated container images and executable paths KRM function plugins of components may use. Function plugins are refused when empty.")
+}
+
+// Complete sets the options parsed from their flags once these are parsed, and validates them
+func (r *Render) Complete() error {
+	loadRestrictions, err := kustomize.ParseLoadRestrictions(r.loadRestrictor)
+	if err != nil {
+		return fmt.Errorf("invalid kustomize load restrictor: %w", err)
+	}
+	r.Kustomize.LoadRestrictions = loadRestrictions
+	r.Kustomize.AllowedFunctions = nil
+	if r.allowedFunctions != "" {
+		r.Kustomize.AllowedFunctions = strings.Split(r.allowedFunctions, ",")
+	}
+	err = r.Kustomize.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid kustomize options: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package options
+
+import (
+	"flag"
+	"github.com/thalleslmF/go-operator/internal/repository"
+	"reflect"
+	"sigs.k8s.io/kustomize/api/types"
+	"testing"
+	"time"
+)
+
+func TestRenderComplete(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments []string
+		expected  Render
+		err       bool
+	}{
+		{
+			name: "defaults",
+			expected: Render{
+				Repository: repository.Options{MaxFileSize: 10 << 20, MaxTotalSize: 100 << 20, Workers: 4, RequestTimeout: 30 * time.Second, Retries: 3},
+			},
+		},
+		{
+			name:      "overridden",
+			arguments: []string{"-source-download-workers=8"},
+			expected: Render{
+				Repository: repository.Options{MaxFileSize: 10 << 20, MaxTotalSize: 100 << 20, Workers: 8, RequestTimeout: 30 * time.Second, Retries: 3},
+			},
+		},
+		{
+			name:      "unknown load restrictor",
+			arguments: []string{"-kustomize-load-restrictor=anywhere"},
+			err:       true,
+		},
+		{
+			name:      "unknown reorder",
+			arguments: []string{"-kustomize-reorder=alphabetical"},
+			err:       true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			render := Render{}
+			flags := flag.NewFlagSet(test.name, flag.ContinueOnError)
+			render.BindFlags(flags)
+			if err := flags.Parse(test.arguments); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			err := render.Complete()
+
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(render.Repository, test.expected.Repository) {
+				t.Errorf("expected repository options %+v, got %+v", test.expected.Repository, render.Repository)
+			}
+		})
+	}
+}
+
+func TestRenderCompleteParsesKustomizeFlags(t *testing.T) {
+	render := Render{}
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	render.BindFlags(flags)
+	_ = flags.Parse([]string{"-kustomize-load-restrictor=LoadRestrictionsNone", "-kustomize-allowed-functions=example.com/fn:v1,/usr/bin/fn"})
+
+	err := render.Complete()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if render.Kustomize.LoadRestrictions != types.LoadRestrictionsNone || render.Kustomize.HelmCommand != "helm" {
+		t.Errorf("expected the load restrictor and helm command to be set, got %+v", render.Kustomize)
+	}
+	if !reflect.DeepEqual(render.Kustomize.AllowedFunctions, []string{"example.com/fn:v1", "/usr/bin/fn"}) {
+		t.Errorf("expected the allowed functions to be split, got %v", render.Kustomize.AllowedFunctions)
+	}
+}
@@ -0,0 +1,178 @@
+package receiver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/thalleslmF/go-operator/internal/componentspec"
+	"k8s.io/apimachinery/pkg/util/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	refHeadsPrefix = "refs/heads/"
+	refTagsPrefix  = "refs/tags/"
+	sha256Prefix   = "sha256="
+)
+
+var (
+	errUnsupportedEvent = errors.New("unsupported webhook event")
+	errInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// PushEvent is the provider independent view of a git push
+type PushEvent struct {
+	// Provider is the provider that sent the push, whose url parsing matches the components
+	Provider string
+	// Repository is the owner/name of the pushed repository
+	Repository string
+	// Url is the web url of the repository, its host being matched when set
+	Url           string
+	Ref           string
+	DefaultBranch string
+}
+
+type githubPush struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		FullName      string `json:"full_name"`
+		HtmlUrl       string `json:"html_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+type gitlabPush struct {
+	Ref     string `json:"ref"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		WebUrl            string `json:"web_url"`
+		DefaultBranch     string `json:"default_branch"`
+	} `json:"project"`
+}
+
+type bitbucketPush struct {
+	Push struct {
+		Changes []struct {
+			New *struct {
+				Name string `json:"name"`
+			} `json:"new"`
+		} `json:"changes"`
+	} `json:"push"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		Links    struct {
+			Html struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	} `json:"repository"`
+}
+
+// parsePushEvents validates the request signature against secret and returns the pushes it carries
+func parsePushEvents(header http.Header, body []byte, secret []byte) ([]PushEvent, error) {
+	switch {
+	case header.Get("X-GitHub-Event") != "":
+		return parseGithub(header, body, secret)
+	case header.Get("X-Gitlab-Event") != "":
+		return parseGitlab(header, body, secret)
+	case header.Get("X-Event-Key") != "":
+		return parseBitbucket(header, body, secret)
+	default:
+		return nil, errUnsupportedEvent
+	}
+}
+
+func parseGithub(header http.Header, body []byte, secret []byte) ([]PushEvent, error) {
+	if !validSignature(header.Get("X-Hub-Signature-256"), body, secret) {
+		return nil, errInvalidSignature
+	}
+	if header.Get("X-GitHub-Event") != "push" {
+		return nil, errUnsupportedEvent
+	}
+	var push githubPush
+	err := json.Unmarshal(body, &push)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding github push: %w", err)
+	}
+	return []PushEvent{{
+		Provider:      componentspec.GithubProvider,
+		Repository:    push.Repository.FullName,
+		Url:           push.Repository.HtmlUrl,
+		Ref:           trimRef(push.Ref),
+		DefaultBranch: push.Repository.DefaultBranch,
+	}}, nil
+}
+
+func parseGitlab(header http.Header, body []byte, secret []byte) ([]PushEvent, error) {
+	// GitLab does not sign payloads, it echoes the configured secret token instead
+	if len(secret) == 0 || subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), secret) != 1 {
+		return nil, errInvalidSignature
+	}
+	event := header.Get("X-Gitlab-Event")
+	if event != "Push Hook" && event != "Tag Push Hook" {
+		return nil, errUnsupportedEvent
+	}
+	var push gitlabPush
+	err := json.Unmarshal(body, &push)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding gitlab push: %w", err)
+	}
+	return []PushEvent{{
+		Provider:      componentspec.GitlabProvider,
+		Repository:    push.Project.PathWithNamespace,
+		Url:           push.Project.WebUrl,
+		Ref:           trimRef(push.Ref),
+		DefaultBranch: push.Project.DefaultBranch,
+	}}, nil
+}
+
+func parseBitbucket(header http.Header, body []byte, secret []byte) ([]PushEvent, error) {
+	if !validSignature(header.Get("X-Hub-Signature"), body, secret) {
+		return nil, errInvalidSignature
+	}
+	if header.Get("X-Event-Key") != "repo:push" {
+		return nil, errUnsupportedEvent
+	}
+	var push bitbucketPush
+	err := json.Unmarshal(body, &push)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding bitbucket push: %w", err)
+	}
+	var events []PushEvent
+	for _, change := range push.Push.Changes {
+		// deleted branches and tags have no new state to sync
+		if change.New == nil {
+			continue
+		}
+		events = append(events, PushEvent{
+			Provider:   componentspec.BitbucketProvider,
+			Repository: push.Repository.FullName,
+			Url:        push.Repository.Links.Html.Href,
+			Ref:        change.New.Name,
+		})
+	}
+	return events, nil
+}
+
+// validSignature checks a "sha256=<hex>" HMAC of body keyed with secret
+func validSignature(signature string, body []byte, secret []byte) bool {
+	if len(secret) == 0 || !strings.HasPrefix(signature, sha256Prefix) {
+		return false
+	}
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, sha256Prefix))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func trimRef(ref string) string {
+	ref = strings.TrimPrefix(ref, refHeadsPrefix)
+	return strings.TrimPrefix(ref, refTagsPrefix)
+}
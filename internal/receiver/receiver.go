@@ -0,0 +1,190 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/common/log"
+	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
+	"github.com/thalleslmF/go-operator/internal/componentspec"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	"net/http"
+	"net/url"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"strings"
+	"time"
+)
+
+const (
+	// SecretKey is the key of the webhook Secret holding the shared secret
+	SecretKey = "secret"
+	// maxPayloadSize matches the largest payload GitHub delivers
+	maxPayloadSize = 25 << 20
+	// shutdownTimeout is how long the requests in flight may take once the receiver stops
+	shutdownTimeout = 10 * time.Second
+	// notLeaderRetryAfter is the Retry-After, in seconds, of the pushes received by a replica that does not lead
+	notLeaderRetryAfter = "10"
+)
+
+// Receiver accepts git push webhooks and sends the CharlesDeployments whose components
+// track the pushed repository and ref to the controller
+type Receiver struct {
+	Client client.Client
+	Events chan<- event.GenericEvent
+	Secret client.ObjectKey
+	Addr   string
+	// Elected is closed once the replica leads, only the leader running the controller reading Events
+	Elected <-chan struct{}
+}
+
+// NeedLeaderElection serves the webhooks on every replica so their Service always has endpoints,
+// the replicas that do not lead answering 503
+func (r Receiver) NeedLeaderElection() bool {
+	return false
+}
+
+func (r Receiver) leading() bool {
+	if r.Elected == nil {
+		return true
+	}
+	select {
+	case <-r.Elected:
+		return true
+	default:
+		return false
+	}
+}
+
+// Start serves the webhooks until the context is done, letting the requests in flight finish
+func (r Receiver) Start(ctx context.Context) error {
+	log.Info("Starting webhook receiver on ", r.Addr)
+	server := &http.Server{Addr: r.Addr, Handler: r}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+func (r Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !r.leading() {
+		w.Header().Set("Retry-After", notLeaderRetryAfter)
+		http.Error(w, "this replica does not lead, retry later", http.StatusServiceUnavailable)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	secret, err := r.getSecret(req.Context())
+	if err != nil {
+		log.Error("Error getting webhook secret ", err)
+		http.Error(w, "webhook secret not available", http.StatusInternalServerError)
+		return
+	}
+	events, err := parsePushEvents(req.Header, body, secret)
+	if errors.Is(err, errInvalidSignature) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, errUnsupportedEvent) {
+		// acknowledge pings and other events so providers do not flag the hook as failing
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	enqueued, err := r.enqueue(req.Context(), events)
+	if err != nil {
+		log.Error("Error enqueueing charles deployments ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "enqueued %d charles deployments\n", enqueued)
+}
+
+func (r Receiver) getSecret(ctx context.Context) ([]byte, error) {
+	secret := &corev1.Secret{}
+	err := r.Client.Get(ctx, r.Secret, secret)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := secret.Data[SecretKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no %s key", r.Secret, SecretKey)
+	}
+	return value, nil
+}
+
+func (r Receiver) enqueue(ctx context.Context, events []PushEvent) (int, error) {
+	charlesDeployments := &iocharlescdv1.CharlesDeploymentList{}
+	err := r.Client.List(ctx, charlesDeployments)
+	if err != nil {
+		return 0, err
+	}
+	enqueued := 0
+	for i := range charlesDeployments.Items {
+		if !tracksAnyEvent(charlesDeployments.Items[i], events) {
+			continue
+		}
+		log.Info("Enqueueing charles deployment after push ", client.ObjectKeyFromObject(&charlesDeployments.Items[i]))
+		select {
+		case r.Events <- event.GenericEvent{Object: &charlesDeployments.Items[i]}:
+		case <-ctx.Done():
+			return enqueued, ctx.Err()
+		}
+		enqueued++
+	}
+	return enqueued, nil
+}
+
+// tracksAnyEvent tells whether a component tracks a pushed repository and ref, its chart url
+// being parsed the way the provider of the push spells repository urls
+func tracksAnyEvent(charlesDeployment iocharlescdv1.CharlesDeployment, events []PushEvent) bool {
+	for _, component := range charlesDeployment.Spec.Components {
+		for _, event := range events {
+			location, err := componentspec.ParseRepositoryURL(event.Provider, component.Chart)
+			if err != nil {
+				continue
+			}
+			ref := component.Ref
+			if ref == "" {
+				ref = location.Ref
+			}
+			if tracks(location, ref, event) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func tracks(location componentspec.Location, ref string, event PushEvent) bool {
+	if !strings.EqualFold(location.FullName(), event.Repository) {
+		return false
+	}
+	if eventUrl, err := url.Parse(event.Url); err == nil && eventUrl.Host != "" && !strings.EqualFold(eventUrl.Host, location.Host) {
+		return false
+	}
+	if ref == "" {
+		return event.DefaultBranch == "" || event.Ref == event.DefaultBranch
+	}
+	return ref == event.Ref
+}
@@ -0,0 +1,237 @@
+package receiver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"strings"
+	"testing"
+)
+
+var secret = []byte("shared-secret")
+
+const (
+	githubPayload    = `{"ref":"refs/heads/main","repository":{"full_name":"org/app","html_url":"https://github.com/org/app","default_branch":"main"}}`
+	gitlabPayload    = `{"ref":"refs/heads/main","project":{"path_with_namespace":"group/sub/app","web_url":"https://gitlab.com/group/sub/app","default_branch":"main"}}`
+	bitbucketPayload = `{"push":{"changes":[{"new":{"name":"main"}},{"new":null}]},"repository":{"full_name":"team/app","links":{"html":{"href":"https://bitbucket.org/team/app"}}}}`
+)
+
+func sign(body string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	return sha256Prefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestParsePushEventsSignatures(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  map[string]string
+		body    string
+		wantErr error
+		want    PushEvent
+	}{
+		{
+			name:   "github valid signature",
+			header: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": sign(githubPayload, secret)},
+			body:   githubPayload,
+			want:   PushEvent{Provider: "GITHUB", Repository: "org/app", Url: "https://github.com/org/app", Ref: "main", DefaultBranch: "main"},
+		},
+		{
+			name:    "github missing signature",
+			header:  map[string]string{"X-GitHub-Event": "push"},
+			body:    githubPayload,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:    "github forged signature",
+			header:  map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": sign(githubPayload, []byte("other"))},
+			body:    githubPayload,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:    "github signature of another payload",
+			header:  map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": sign(gitlabPayload, secret)},
+			body:    githubPayload,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:   "gitlab valid token",
+			header: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": string(secret)},
+			body:   gitlabPayload,
+			want:   PushEvent{Provider: "GITLAB", Repository: "group/sub/app", Url: "https://gitlab.com/group/sub/app", Ref: "main", DefaultBranch: "main"},
+		},
+		{
+			name:    "gitlab missing token",
+			header:  map[string]string{"X-Gitlab-Event": "Push Hook"},
+			body:    gitlabPayload,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:    "gitlab forged token",
+			header:  map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "other"},
+			body:    gitlabPayload,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:   "bitbucket valid signature",
+			header: map[string]string{"X-Event-Key": "repo:push", "X-Hub-Signature": sign(bitbucketPayload, secret)},
+			body:   bitbucketPayload,
+			want:   PushEvent{Provider: "BITBUCKET", Repository: "team/app", Url: "https://bitbucket.org/team/app", Ref: "main"},
+		},
+		{
+			name:    "bitbucket missing signature",
+			header:  map[string]string{"X-Event-Key": "repo:push"},
+			body:    bitbucketPayload,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:    "bitbucket forged signature",
+			header:  map[string]string{"X-Event-Key": "repo:push", "X-Hub-Signature": sign(bitbucketPayload, []byte("other"))},
+			body:    bitbucketPayload,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:    "unknown provider",
+			header:  map[string]string{},
+			body:    githubPayload,
+			wantErr: errUnsupportedEvent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range test.header {
+				header.Set(key, value)
+			}
+			events, err := parsePushEvents(header, []byte(test.body), secret)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("expected error %v, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(events) != 1 || events[0] != test.want {
+				t.Errorf("expected event %+v, got %+v", test.want, events)
+			}
+		})
+	}
+}
+
+func TestParsePushEventsWithoutSecret(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Gitlab-Event", "Push Hook")
+	_, err := parsePushEvents(header, []byte(gitlabPayload), nil)
+	if !errors.Is(err, errInvalidSignature) {
+		t.Errorf("expected an empty secret to refuse tokenless pushes, got %v", err)
+	}
+}
+
+func deployment(chart string, ref string) iocharlescdv1.CharlesDeployment {
+	return iocharlescdv1.CharlesDeployment{Spec: iocharlescdv1.CharlesDeploymentSpec{
+		Components: []iocharlescdv1.Component{{Name: "app", Chart: chart, Ref: ref}},
+	}}
+}
+
+func TestTracksAnyEvent(t *testing.T) {
+	github := PushEvent{Provider: "GITHUB", Repository: "org/app", Url: "https://github.com/org/app", Ref: "main", DefaultBranch: "main"}
+	enterprise := PushEvent{Provider: "GITHUB", Repository: "org/app", Url: "https://github.example.com/org/app", Ref: "main", DefaultBranch: "main"}
+	gitlab := PushEvent{Provider: "GITLAB", Repository: "group/sub/app", Url: "https://gitlab.com/group/sub/app", Ref: "main", DefaultBranch: "main"}
+	bitbucket := PushEvent{Provider: "BITBUCKET", Repository: "team/app", Url: "https://bitbucket.org/team/app", Ref: "release"}
+	tests := []struct {
+		name  string
+		chart string
+		ref   string
+		event PushEvent
+		want  bool
+	}{
+		{name: "github default branch", chart: "https://github.com/org/app//deploy", event: github, want: true},
+		{name: "github contents api url", chart: "https://api.github.com/repos/org/app/contents/deploy", ref: "main", event: github, want: true},
+		{name: "github other ref", chart: "https://github.com/org/app//deploy", ref: "release", event: github},
+		{name: "github ref in url", chart: "https://github.com/org/app//deploy?ref=main", event: github, want: true},
+		{name: "github other repository", chart: "https://github.com/org/other", event: github},
+		{name: "github enterprise", chart: "https://github.example.com/org/app//deploy", ref: "main", event: enterprise, want: true},
+		{name: "github other host", chart: "https://github.com/org/app//deploy", ref: "main", event: enterprise},
+		{name: "gitlab nested group", chart: "https://gitlab.com/group/sub/app//deploy", ref: "main", event: gitlab, want: true},
+		{name: "gitlab web url", chart: "https://gitlab.com/group/sub/app/-/tree/main/deploy", ref: "main", event: gitlab, want: true},
+		{name: "gitlab other group", chart: "https://gitlab.com/group/app//deploy", ref: "main", event: gitlab},
+		{name: "bitbucket", chart: "https://bitbucket.org/team/app//deploy", ref: "release", event: bitbucket, want: true},
+		{name: "bitbucket web url", chart: "https://bitbucket.org/team/app/src/release/deploy", ref: "release", event: bitbucket, want: true},
+		{name: "bitbucket other ref", chart: "https://bitbucket.org/team/app//deploy", ref: "main", event: bitbucket},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := tracksAnyEvent(deployment(test.chart, test.ref), []PushEvent{test.event})
+			if got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+		})
+	}
+}
+
+func TestServeHTTPSendsTrackingDeployments(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = iocharlescdv1.AddToScheme(scheme)
+	tracking := deployment("https://gitlab.com/group/sub/app//deploy", "main")
+	tracking.ObjectMeta = metav1.ObjectMeta{Name: "tracking", Namespace: "default"}
+	other := deployment("https://gitlab.com/group/other//deploy", "main")
+	other.ObjectMeta = metav1.ObjectMeta{Name: "other", Namespace: "default"}
+	webhookSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: "system"},
+		Data:       map[string][]byte{SecretKey: secret},
+	}
+	events := make(chan event.GenericEvent, 2)
+	receiver := Receiver{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(&tracking, &other, webhookSecret).Build(),
+		Events: events,
+		Secret: client.ObjectKey{Namespace: "system", Name: "webhook"},
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(gitlabPayload))
+	request.Header.Set("X-Gitlab-Event", "Push Hook")
+	request.Header.Set("X-Gitlab-Token", string(secret))
+	response := httptest.NewRecorder()
+	receiver.ServeHTTP(response, request)
+
+	if response.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, response.Code, response.Body)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one deployment to be sent, got %d", len(events))
+	}
+	if name := (<-events).Object.GetName(); name != "tracking" {
+		t.Errorf("expected the tracking deployment to be sent, got %s", name)
+	}
+}
+
+func TestServeHTTPRefusesPushesUntilElected(t *testing.T) {
+	elected := make(chan struct{})
+	receiver := Receiver{Elected: elected}
+	if receiver.NeedLeaderElection() {
+		t.Errorf("expected the receiver to serve on every replica")
+	}
+
+	recorder := httptest.NewRecorder()
+	receiver.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(gitlabPayload)))
+
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a 503 with Retry-After before being elected, got %d", recorder.Code)
+	}
+	close(elected)
+	if !receiver.leading() {
+		t.Errorf("expected the receiver to lead once elected")
+	}
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"strconv"
+)
+
+// Keys read from the Secret referenced by a component
+const (
+	TokenKey          = "token"
+	AppIDKey          = "appID"
+	InstallationIDKey = "installationID"
+	PrivateKeyKey     = "privateKey"
+)
+
+// CACertKey is the ConfigMap key holding the PEM bundle trusted when reaching the provider
+const CACertKey = "ca.crt"
+
+// Credentials authenticate the provider requests, App takes precedence over Token
+type Credentials struct {
+	Token string
+	App   *AppCredentials
+	// CACert, ClientCert and ClientKey are PEM encoded and only needed for providers behind an internal PKI
+	CACert     []byte
+	ClientCert []byte
+	ClientKey  []byte
+}
+
+// AppCredentials identify a GitHub App installation
+type AppCredentials struct {
+	AppID          int64
+	InstallationID int64
+	PrivateKey     []byte
+}
+
+// CredentialsFromSecret reads app credentials when the Secret has an app ID, falling back to a personal token
+func CredentialsFromSecret(secret corev1.Secret) (Credentials, error) {
+	credentials := Credentials{
+		Token:      string(secret.Data[TokenKey]),
+		ClientCert: secret.Data[corev1.TLSCertKey],
+		ClientKey:  secret.Data[corev1.TLSPrivateKeyKey],
+	}
+	if _, ok := secret.Data[AppIDKey]; !ok {
+		return credentials, nil
+	}
+	appID, err := strconv.ParseInt(string(secret.Data[AppIDKey]), 10, 64)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("invalid %s in secret %s: %w", AppIDKey, secret.Name, err)
+	}
+	installationID, err := strconv.ParseInt(string(secret.Data[InstallationIDKey]), 10, 64)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("invalid %s in secret %s: %w", InstallationIDKey, secret.Name, err)
+	}
+	if len(secret.Data[PrivateKeyKey]) == 0 {
+		return Credentials{}, fmt.Errorf("secret %s has no %s", secret.Name, PrivateKeyKey)
+	}
+	credentials.App = &AppCredentials{
+		AppID:          appID,
+		InstallationID: installationID,
+		PrivateKey:     secret.Data[PrivateKeyKey],
+	}
+	return credentials, nil
+}
+
+func (c Credentials) tlsConfig() (*tls.Config, error) {
+	if len(c.CACert) == 0 && len(c.ClientCert) == 0 {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{}
+	if len(c.CACert) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(c.CACert) {
+			return nil, fmt.Errorf("no certificates found in %s", CACertKey)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(c.ClientCert) > 0 {
+		certificate, err := tls.X509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
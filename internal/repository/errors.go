@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+)
+
+// NotFoundError is returned when the repository, ref or path does not exist
+type NotFoundError struct {
+	Url string
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("%s not found", e.Url)
+}
+
+// UnauthorizedError is returned when the provider rejects the configured credentials
+type UnauthorizedError struct {
+	Url string
+}
+
+func (e UnauthorizedError) Error() string {
+	return fmt.Sprintf("unauthorized to access %s", e.Url)
+}
+
+// RateLimitedError is returned when the provider quota is exhausted, RetryAfter
+// is how long to wait before calling the provider again
+type RateLimitedError struct {
+	Url        string
+	RetryAfter time.Duration
+}
+
+func (e RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited accessing %s, retry after %s", e.Url, e.RetryAfter)
+}
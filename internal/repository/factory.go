@@ -1,18 +1,59 @@
 package repository
 
 import (
+	"context"
 	"fmt"
+	"github.com/thalleslmF/go-operator/internal/componentspec"
+	"time"
 )
 
 type Repository interface {
-	GetContent() ([]map[string]interface{}, error)
-	DownloadContents(repoContent []map[string]interface{}, file string) error
+	// ResolveRevision resolves a branch, tag or commit SHA to an immutable commit SHA
+	ResolveRevision(ctx context.Context, ref string) (string, error)
+	// FullName returns the owner/name of the repository
+	FullName() string
+	// Ref returns the ref pinned in the repository url, used when the component sets none
+	Ref() string
+	// Path returns the directory, relative to the repository root, the content is fetched from
+	Path() string
+	// GetContent lists the whole tree at revision whatever the Path, so a download can be
+	// cached and shared by the components of the repository
+	GetContent(ctx context.Context, revision string) ([]map[string]interface{}, error)
+	DownloadContents(ctx context.Context, repoContent []map[string]interface{}, dir string) (DownloadSummary, error)
 }
 
-func NewRepository(Provider string, url string, token string) (Repository, error) {
+// DownloadSummary describes a completed download
+type DownloadSummary struct {
+	Files    int
+	Bytes    int64
+	Duration time.Duration
+}
+
+// Options bound what a provider is allowed to download
+type Options struct {
+	// MaxFileSize and MaxTotalSize are the most bytes downloaded for a single file and a
+	// whole source, unlimited when zero
+	MaxFileSize  int64
+	MaxTotalSize int64
+	// Workers is how many files are downloaded in parallel, defaulting to one
+	Workers int
+	// RequestTimeout bounds each request and Retries is how many times requests
+	// failing with a network or server error are retried
+	RequestTimeout time.Duration
+	Retries        int
+}
+
+func (o Options) workers() int {
+	if o.Workers < 1 {
+		return 1
+	}
+	return o.Workers
+}
+
+func NewRepository(Provider string, url string, credentials Credentials, options Options) (Repository, error) {
 	switch Provider {
-	case "GITHUB":
-		return Github{Url: url, Token: token}, nil
+	case componentspec.GithubProvider:
+		return NewGithub(url, credentials, options)
 	default:
 		return nil, fmt.Errorf("provider %s not supported", Provider)
 	}
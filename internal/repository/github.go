@@ -1,99 +1,307 @@
 package repository
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"github.com/prometheus/common/log"
+	"github.com/thalleslmF/go-operator/internal/componentspec"
+	"golang.org/x/sync/errgroup"
 	"gopkg.in/resty.v1"
 	"k8s.io/apimachinery/pkg/util/json"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	githubDefaultRef     = "HEAD"
+	githubTreeType       = "tree"
+	githubBlobType       = "blob"
+	githubCommitType     = "commit"
+	githubExecutableMode = "100755"
+	githubSymlinkMode    = "120000"
 )
 
 type Github struct {
-	Url   string
-	Token string
+	Url         string
+	Credentials Credentials
+	Options     Options
+	location    githubLocation
+	// client is shared by the requests of the provider, keeping its connections alive between them
+	client *resty.Client
+}
+
+// treeEntry is an entry of the git trees API
+type treeEntry struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	Url  string `json:"url"`
+	// localPath is where the entry is written
+	localPath string
 }
 
-func (g Github) GetContent() ([]map[string]interface{}, error) {
-	client := resty.New()
-	resp, err := client.R().SetHeader("Authorization", fmt.Sprintf("Token %s", g.Token)).Get(g.Url)
+func NewGithub(url string, credentials Credentials, options Options) (Github, error) {
+	location, err := componentspec.ParseURL(componentspec.GithubProvider, url)
 	if err != nil {
-		return nil, err
+		return Github{}, err
+	}
+	client, err := newGithubClient(credentials, options)
+	if err != nil {
+		return Github{}, err
+	}
+	return Github{Url: url, Credentials: credentials, Options: options, location: githubLocation{location}, client: client}, nil
+}
+
+func newTreeEntry(value map[string]interface{}) (treeEntry, error) {
+	var entry treeEntry
+	entryBytes, err := json.Marshal(value)
+	if err != nil {
+		return entry, err
+	}
+	err = json.Unmarshal(entryBytes, &entry)
+	return entry, err
+}
+
+func (g Github) ResolveRevision(ctx context.Context, ref string) (string, error) {
+	if ref == "" {
+		ref = g.Ref()
+	}
+	if ref == "" {
+		ref = githubDefaultRef
+	}
+	body, err := g.request(ctx, fmt.Sprintf("%s/commits/%s", g.location.repoApiUrl(), url.PathEscape(ref)), githubShaMediaType, true)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func (g Github) FullName() string {
+	return g.location.FullName()
+}
+
+func (g Github) Path() string {
+	return g.location.Path
+}
+
+func (g Github) Ref() string {
+	return g.location.Ref
+}
+
+// GetContent lists the entries of the whole repository tree at revision. Like a kustomize `//`
+// url, Path only selects the root of the component, which may refer to files outside of it.
+func (g Github) GetContent(ctx context.Context, revision string) ([]map[string]interface{}, error) {
+	return g.listTree(ctx, revision, "", true)
+}
+
+// listTree lists the entries of a tree, prefixing their path with prefix. GitHub truncates the recursive
+// listings of large trees, which are then listed one level at a time, walking into each subtree.
+func (g Github) listTree(ctx context.Context, sha string, prefix string, recursive bool) ([]map[string]interface{}, error) {
+	treeUrl := fmt.Sprintf("%s/git/trees/%s", g.location.repoApiUrl(), url.PathEscape(sha))
+	if recursive {
+		treeUrl += "?recursive=1"
 	}
-	var contentList []map[string]interface{}
-	err = json.Unmarshal(resp.Body(), &contentList)
+	body, err := g.request(ctx, treeUrl, githubJsonMediaType, true)
 	if err != nil {
 		return nil, err
 	}
-	return contentList, nil
+	var tree struct {
+		Tree      []map[string]interface{} `json:"tree"`
+		Truncated bool                     `json:"truncated"`
+	}
+	err = json.Unmarshal(body, &tree)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding github tree of %s: %w", g.FullName(), err)
+	}
+	if tree.Truncated && recursive {
+		log.Info(fmt.Sprintf("Github tree of %s at /%s is truncated, listing its subtrees", g.FullName(), prefix))
+		return g.listTree(ctx, sha, prefix, false)
+	}
+	if tree.Truncated {
+		return nil, fmt.Errorf("github tree of %s at /%s has too many entries to be listed", g.FullName(), prefix)
+	}
+	var entries []map[string]interface{}
+	for _, entry := range tree.Tree {
+		path, _ := entry["path"].(string)
+		if prefix != "" {
+			path = fmt.Sprintf("%s/%s", prefix, path)
+			entry["path"] = path
+		}
+		entries = append(entries, entry)
+		if recursive || entry["type"] != githubTreeType {
+			continue
+		}
+		subtreeSha, _ := entry["sha"].(string)
+		subtree, err := g.listTree(ctx, subtreeSha, path, true)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, subtree...)
+	}
+	return entries, nil
 }
-func (g Github) DownloadContents(repoContent []map[string]interface{}, file string) error {
-	fmt.Println("Start download content")
+
+// DownloadContents writes the tree entries listed by GetContent to dir, at
+// their repository relative path, byte for byte and keeping the executable bit of files.
+// Symlinks must stay inside dir and submodules are skipped.
+// Files are downloaded by Options.Workers workers, all of them stopping on the first error or
+// once ctx is done.
+func (g Github) DownloadContents(ctx context.Context, repoContent []map[string]interface{}, dir string) (DownloadSummary, error) {
+	log.Info(fmt.Sprintf("Start download of %s", g.FullName()))
+	start := time.Now()
+	summary := DownloadSummary{}
+	var blobs []treeEntry
 	for _, value := range repoContent {
-		if value["download_url"] != nil {
-			err := g.downloadContent(fmt.Sprintf("%s/%s", file, value["path"].(string)), value["url"].(string), g.Token)
-			if err != nil {
-				return err
+		entry, err := newTreeEntry(value)
+		if err != nil {
+			return summary, err
+		}
+		entry.localPath, err = securePath(dir, entry.Path)
+		if err != nil {
+			return summary, err
+		}
+		switch {
+		case entry.Type == githubTreeType:
+			err = os.MkdirAll(entry.localPath, 0755)
+		case entry.Type == githubCommitType:
+			log.Info(fmt.Sprintf("Skipping submodule %s of %s", entry.Path, g.FullName()))
+		case entry.Type == githubBlobType:
+			if g.Options.MaxFileSize > 0 && entry.Size > g.Options.MaxFileSize {
+				return summary, fmt.Errorf("file %s of %s exceeds the %d bytes limit", entry.Path, g.FullName(), g.Options.MaxFileSize)
 			}
-		} else {
-			contents, err := g.getUrlContent(value["url"].(string), g.Token)
-			if err != nil {
-				return err
+			summary.Files++
+			summary.Bytes += entry.Size
+			if g.Options.MaxTotalSize > 0 && summary.Bytes > g.Options.MaxTotalSize {
+				return summary, fmt.Errorf("source %s exceeds the %d bytes limit", g.FullName(), g.Options.MaxTotalSize)
 			}
-			err = g.DownloadContents(contents, file)
-			if err != nil {
-				return err
+			blobs = append(blobs, entry)
+		default:
+			err = fmt.Errorf("unsupported entry %s of type %s in %s", entry.Path, entry.Type, g.FullName())
+		}
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	entries := make(chan treeEntry)
+	group.Go(func() error {
+		defer close(entries)
+		for _, entry := range blobs {
+			select {
+			case entries <- entry:
+			case <-groupCtx.Done():
+				return groupCtx.Err()
 			}
 		}
+		return nil
+	})
+	for i := 0; i < g.Options.workers(); i++ {
+		group.Go(func() error {
+			for entry := range entries {
+				err := g.downloadEntry(groupCtx, dir, entry)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	err := group.Wait()
+	summary.Duration = time.Since(start)
+	return summary, err
+}
+
+func (g Github) downloadEntry(ctx context.Context, dir string, entry treeEntry) error {
+	if entry.Mode == githubSymlinkMode {
+		return g.downloadSymlink(ctx, dir, entry.localPath, entry)
 	}
-	return nil
+	return g.downloadContent(ctx, entry.localPath, entry)
 }
 
-func (g Github) downloadContent(path string, gitUrl string, token string) error {
-	// Create the file
-	fmt.Println("Downloading content", path)
-	fmt.Println("Download url", gitUrl)
-	client := resty.New()
-	resp, err := client.R().SetHeader("Authorization", fmt.Sprintf("Token %s", token)).Get(gitUrl)
+func (g Github) downloadContent(ctx context.Context, path string, entry treeEntry) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
 	if err != nil {
 		return err
 	}
-	if resp.IsError() {
-		return fmt.Errorf("bad status: %s", resp.Status)
+	perm := os.FileMode(0644)
+	if entry.Mode == githubExecutableMode {
+		perm = 0755
 	}
+	return g.download(ctx, entry.Url, path, perm, g.Options.MaxFileSize)
+}
 
-	file, err := os.Create(path)
-	if os.IsNotExist(err) {
-		pathDir := filepath.Dir(path)
-		fmt.Println(pathDir)
-		os.MkdirAll(pathDir, 0766)
-		file, err = os.Create(path)
-		os.Create(path)
-	}
+// downloadSymlink recreates a symlink whose blob holds the link target, refusing targets outside dir
+func (g Github) downloadSymlink(ctx context.Context, dir string, path string, entry treeEntry) error {
+	body, err := g.request(ctx, entry.Url, githubRawMediaType, false)
 	if err != nil {
 		return err
 	}
-	bytesResponse, err := json.Marshal(resp.Body())
+	target := string(body)
+	if filepath.IsAbs(target) {
+		return fmt.Errorf("symlink %s of %s points to absolute path %s", entry.Path, g.FullName(), target)
+	}
+	_, err = securePath(dir, filepath.Join(filepath.Dir(entry.Path), target))
 	if err != nil {
-		fmt.Println("Error: ", err)
 		return err
 	}
-	_, err = file.Write(bytesResponse)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
 	if err != nil {
 		return err
 	}
-	return nil
+	return os.Symlink(target, path)
 }
 
-func (g Github) getUrlContent(url string, token string) ([]map[string]interface{}, error) {
-	client := resty.New()
-	resp, err := client.R().SetHeader("Authorization", fmt.Sprintf("token %s", token)).Get(url)
+// newGithubClient returns a resty client trusting the configured CA and presenting the configured client certificate.
+// Its transport is cloned from the default one to keep the proxy settings and connection timeouts.
+func newGithubClient(credentials Credentials, options Options) (*resty.Client, error) {
+	tlsConfig, err := credentials.tlsConfig()
 	if err != nil {
 		return nil, err
 	}
-	var contentList []map[string]interface{}
-	err = json.Unmarshal(resp.Body(), &contentList)
-	if err != nil {
-		return nil, err
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	client := resty.New().SetTransport(transport)
+	if options.RequestTimeout > 0 {
+		client.SetTimeout(options.RequestTimeout)
+	}
+	if options.Retries > 0 {
+		client.SetRetryCount(options.Retries).AddRetryCondition(func(resp *resty.Response) (bool, error) {
+			return resp != nil && resp.StatusCode() >= http.StatusInternalServerError, nil
+		})
+	}
+	return client, nil
+}
+
+// authorization returns the Authorization header value, minting an installation token when an app is configured
+func (g Github) authorization(ctx context.Context) (string, error) {
+	if g.Credentials.App != nil {
+		token, err := g.installationToken(ctx)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Token %s", token), nil
+	}
+	if g.Credentials.Token != "" {
+		return fmt.Sprintf("Token %s", g.Credentials.Token), nil
+	}
+	return "", nil
+}
+
+// identity distinguishes the credentials a response was fetched with, without embedding short lived tokens
+func (g Github) identity() string {
+	if g.Credentials.App != nil {
+		return fmt.Sprintf("app:%d:%d", g.Credentials.App.AppID, g.Credentials.App.InstallationID)
 	}
-	return contentList, nil
+	sum := sha256.Sum256([]byte(g.Credentials.Token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/prometheus/common/log"
+	"gopkg.in/resty.v1"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	githubJsonMediaType = "application/vnd.github.v3+json"
+	githubShaMediaType  = "application/vnd.github.v3.sha"
+	githubRawMediaType  = "application/vnd.github.v3.raw"
+	// githubErrorMaxSize bounds how much of an error response is read
+	githubErrorMaxSize = 1 << 20
+	// secondaryRateLimitMaxWait is the longest Retry-After honoured in place, longer waits are returned to the caller
+	secondaryRateLimitMaxWait   = time.Minute
+	secondaryRateLimitRetries   = 3
+	secondaryRateLimitBackoff   = 10 * time.Second
+	githubEtagCacheMaxEntries   = 1024
+	githubRateLimitRemainingKey = "X-RateLimit-Remaining"
+	githubRateLimitResetKey     = "X-RateLimit-Reset"
+)
+
+// githubEtags remembers the last response of conditional requests, so unchanged
+// resources are answered with a 304 that does not count against the quota
+var githubEtags = newEtagCache(githubEtagCacheMaxEntries)
+
+// etagCache keeps the responses of the maxEntries most recently used requests
+type etagCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	// recent orders the entries from the most to the least recently used
+	recent *list.List
+}
+
+type etagEntry struct {
+	etag string
+	body []byte
+}
+
+// etagElement is an entry of the recent list, which needs its key to be removed from entries
+type etagElement struct {
+	key   string
+	entry etagEntry
+}
+
+func newEtagCache(maxEntries int) *etagCache {
+	return &etagCache{maxEntries: maxEntries, entries: make(map[string]*list.Element), recent: list.New()}
+}
+
+func (c *etagCache) get(key string) (etagEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return etagEntry{}, false
+	}
+	c.recent.MoveToFront(element)
+	return element.Value.(*etagElement).entry, true
+}
+
+// set stores the entry of key, evicting the least recently used entry when the cache is full
+func (c *etagCache) set(key string, entry etagEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*etagElement).entry = entry
+		c.recent.MoveToFront(element)
+		return
+	}
+	if c.recent.Len() >= c.maxEntries {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*etagElement).key)
+	}
+	c.entries[key] = c.recent.PushFront(&etagElement{key: key, entry: entry})
+}
+
+// request performs a GET against the GitHub API, returning the body. Conditional requests are
+// used when conditional is set. The endpoints used are not paginated.
+func (g Github) request(ctx context.Context, url string, accept string, conditional bool) ([]byte, error) {
+	cacheKey := fmt.Sprintf("%s|%s|%s", accept, g.identity(), url)
+	cached, hasCached := githubEtags.get(cacheKey)
+	for attempt := 0; ; attempt++ {
+		authorization, err := g.authorization(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req := g.client.R().SetContext(ctx).SetHeader("Accept", accept)
+		if authorization != "" {
+			req.SetHeader("Authorization", authorization)
+		}
+		if conditional && hasCached {
+			req.SetHeader("If-None-Match", cached.etag)
+		}
+		resp, err := req.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.StatusCode() == http.StatusNotModified && hasCached:
+			return cached.body, nil
+		case !resp.IsError():
+			if conditional && resp.Header().Get("ETag") != "" {
+				githubEtags.set(cacheKey, etagEntry{etag: resp.Header().Get("ETag"), body: resp.Body()})
+			}
+			return resp.Body(), nil
+		}
+		err = githubError(url, resp, resp.Body())
+		rateLimited, ok := err.(RateLimitedError)
+		if !ok || attempt >= secondaryRateLimitRetries || rateLimited.RetryAfter > secondaryRateLimitMaxWait {
+			return nil, err
+		}
+		log.Info(fmt.Sprintf("Github rate limit hit for %s, retrying in %s", url, rateLimited.RetryAfter))
+		select {
+		case <-time.After(rateLimited.RetryAfter):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// download streams the raw content of a blob to path, failing once more than maxSize bytes were read
+func (g Github) download(ctx context.Context, url string, path string, perm os.FileMode, maxSize int64) error {
+	authorization, err := g.authorization(ctx)
+	if err != nil {
+		return err
+	}
+	req := g.client.R().SetContext(ctx).SetHeader("Accept", githubRawMediaType).SetDoNotParseResponse(true)
+	if authorization != "" {
+		req.SetHeader("Authorization", authorization)
+	}
+	resp, err := req.Get(url)
+	if err != nil {
+		return err
+	}
+	body := resp.RawBody()
+	defer body.Close()
+	if resp.IsError() {
+		errorBody, _ := ioutil.ReadAll(io.LimitReader(body, githubErrorMaxSize))
+		return githubError(url, resp, errorBody)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := io.Reader(body)
+	if maxSize > 0 {
+		reader = io.LimitReader(body, maxSize+1)
+	}
+	written, err := io.Copy(file, reader)
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && written > maxSize {
+		return fmt.Errorf("%s exceeds the %d bytes limit", path, maxSize)
+	}
+	return nil
+}
+
+func githubError(url string, resp *resty.Response, body []byte) error {
+	switch resp.StatusCode() {
+	case http.StatusNotFound:
+		return NotFoundError{Url: url}
+	case http.StatusUnauthorized:
+		return UnauthorizedError{Url: url}
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		if retryAfter, ok := githubRetryAfter(resp, body); ok {
+			return RateLimitedError{Url: url, RetryAfter: retryAfter}
+		}
+		return UnauthorizedError{Url: url}
+	default:
+		return fmt.Errorf("error requesting %s: %s", url, resp.Status())
+	}
+}
+
+// githubRetryAfter tells whether the response is a primary or secondary rate limit and how long to wait
+func githubRetryAfter(resp *resty.Response, body []byte) (time.Duration, bool) {
+	if retryAfter := resp.Header().Get("Retry-After"); retryAfter != "" {
+		seconds, err := strconv.Atoi(retryAfter)
+		if err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	if resp.Header().Get(githubRateLimitRemainingKey) == "0" {
+		reset, err := strconv.ParseInt(resp.Header().Get(githubRateLimitResetKey), 10, 64)
+		if err != nil {
+			return secondaryRateLimitBackoff, true
+		}
+		retryAfter := time.Until(time.Unix(reset, 0))
+		if retryAfter < 0 {
+			retryAfter = 0
+		}
+		return retryAfter, true
+	}
+	if resp.StatusCode() == http.StatusTooManyRequests || strings.Contains(string(body), "secondary rate limit") {
+		return secondaryRateLimitBackoff, true
+	}
+	return 0, false
+}
+
+// securePath joins a repository relative path to dir, refusing paths escaping it
+func securePath(dir string, path string) (string, error) {
+	joined := filepath.Join(dir, path)
+	if joined != filepath.Clean(dir) && !strings.HasPrefix(joined, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s escapes the download directory", path)
+	}
+	return joined, nil
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEtagCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newEtagCache(2)
+	cache.set("a", etagEntry{etag: "1"})
+	cache.set("b", etagEntry{etag: "2"})
+	cache.get("a")
+
+	cache.set("c", etagEntry{etag: "3"})
+
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := cache.get(key); ok != expected {
+			t.Errorf("expected %s to be cached %t, got %t", key, expected, ok)
+		}
+	}
+}
+
+func TestEtagCacheUpdatesEntries(t *testing.T) {
+	cache := newEtagCache(2)
+	cache.set("a", etagEntry{etag: "1"})
+	cache.set("b", etagEntry{etag: "2"})
+
+	cache.set("a", etagEntry{etag: "3"})
+	cache.set("c", etagEntry{etag: "4"})
+
+	if entry, ok := cache.get("a"); !ok || entry.etag != "3" {
+		t.Errorf("expected a to be updated, got %+v cached %t", entry, ok)
+	}
+	if _, ok := cache.get("b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	inAnHour := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	tests := []struct {
+		name       string
+		status     int
+		headers    map[string]string
+		body       string
+		err        error
+		retryAfter time.Duration
+	}{
+		{name: "not found", status: http.StatusNotFound, err: NotFoundError{}},
+		{name: "unauthorized", status: http.StatusUnauthorized, err: UnauthorizedError{}},
+		{name: "forbidden", status: http.StatusForbidden, body: `{"message":"Resource not accessible"}`, err: UnauthorizedError{}},
+		{
+			name:       "retry after",
+			status:     http.StatusTooManyRequests,
+			headers:    map[string]string{"Retry-After": "120"},
+			err:        RateLimitedError{},
+			retryAfter: 2 * time.Minute,
+		},
+		{
+			name:       "primary rate limit",
+			status:     http.StatusForbidden,
+			headers:    map[string]string{githubRateLimitRemainingKey: "0", githubRateLimitResetKey: inAnHour},
+			err:        RateLimitedError{},
+			retryAfter: time.Hour,
+		},
+		{name: "server error", status: http.StatusBadGateway, err: errors.New("")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				for name, value := range test.headers {
+					w.Header().Set(name, value)
+				}
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, test.body)
+			}))
+			defer server.Close()
+			github, err := NewGithub(server.URL+"/org/repo", Credentials{}, Options{})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			_, err = github.request(context.Background(), server.URL+"/resource", githubJsonMediaType, false)
+
+			if reflect.TypeOf(err) != reflect.TypeOf(test.err) {
+				t.Fatalf("expected a %T, got %#v", test.err, err)
+			}
+			if requests != 1 {
+				t.Errorf("expected a single request, got %d", requests)
+			}
+			if rateLimited, ok := err.(RateLimitedError); ok && (rateLimited.RetryAfter > test.retryAfter || rateLimited.RetryAfter < test.retryAfter-time.Minute) {
+				t.Errorf("expected to retry after %s, got %s", test.retryAfter, rateLimited.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestRequestRetriesShortRateLimits(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, "content")
+	}))
+	defer server.Close()
+	github, err := NewGithub(server.URL+"/org/repo", Credentials{}, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	body, err := github.request(context.Background(), server.URL+"/resource", githubJsonMediaType, false)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(body) != "content" || requests != 2 {
+		t.Errorf("expected the request to be retried once, got %q after %d requests", body, requests)
+	}
+}
+
+func TestRequestAnswersNotModifiedFromCache(t *testing.T) {
+	var requests, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "content")
+	}))
+	defer server.Close()
+	github, err := NewGithub(server.URL+"/org/repo", Credentials{Token: "token"}, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		body, err := github.request(context.Background(), server.URL+"/resource", githubJsonMediaType, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(body) != "content" {
+			t.Errorf("expected the cached content, got %q", body)
+		}
+	}
+
+	if requests != 2 || notModified != 1 {
+		t.Errorf("expected the second request to be conditional, got %d requests and %d not modified", requests, notModified)
+	}
+}
+
+func TestRequestDoesNotShareCacheAcrossCredentials(t *testing.T) {
+	var conditional int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			atomic.AddInt32(&conditional, 1)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "content")
+	}))
+	defer server.Close()
+	for _, token := range []string{"first", "second"} {
+		github, err := NewGithub(server.URL+"/org/repo", Credentials{Token: token}, Options{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		_, err = github.request(context.Background(), server.URL+"/resource", githubJsonMediaType, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if conditional != 0 {
+		t.Errorf("expected no conditional request across credentials, got %d", conditional)
+	}
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/sync/singleflight"
+	"k8s.io/apimachinery/pkg/util/json"
+	"sync"
+	"time"
+)
+
+const (
+	// githubAppJwtTTL stays under the 10 minutes GitHub accepts, backdated to tolerate clock drift
+	githubAppJwtTTL      = 9 * time.Minute
+	githubAppJwtBackdate = time.Minute
+	// installationTokenRefreshWindow refreshes installation tokens before they expire mid-sync
+	installationTokenRefreshWindow = 5 * time.Minute
+)
+
+// installationTokens caches the short lived tokens minted for each app installation
+var installationTokens = &installationTokenCache{tokens: make(map[string]installationToken)}
+
+// installationTokenCache only holds its mutex to read and write tokens, concurrent mints of
+// the token of an installation being shared through mints
+type installationTokenCache struct {
+	mutex  sync.Mutex
+	tokens map[string]installationToken
+	mints  singleflight.Group
+}
+
+func (c *installationTokenCache) get(key string) (installationToken, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	token, ok := c.tokens[key]
+	return token, ok && time.Until(token.ExpiresAt) > installationTokenRefreshWindow
+}
+
+func (c *installationTokenCache) set(key string, token installationToken) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tokens[key] = token
+}
+
+type installationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// installationToken returns a cached installation token, minting a new one when missing or about to expire
+func (g Github) installationToken(ctx context.Context) (string, error) {
+	apiUrl := g.location.ApiUrl
+	key := fmt.Sprintf("%s|%d|%d", apiUrl, g.Credentials.App.AppID, g.Credentials.App.InstallationID)
+	if token, ok := installationTokens.get(key); ok {
+		return token.Token, nil
+	}
+	token, err, _ := installationTokens.mints.Do(key, func() (interface{}, error) {
+		// a mint that just finished may have refreshed the token
+		if token, ok := installationTokens.get(key); ok {
+			return token, nil
+		}
+		token, err := g.mintInstallationToken(ctx, apiUrl)
+		if err != nil {
+			return nil, err
+		}
+		installationTokens.set(key, token)
+		return token, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token.(installationToken).Token, nil
+}
+
+func (g Github) mintInstallationToken(ctx context.Context, apiUrl string) (installationToken, error) {
+	jwt, err := githubAppJwt(g.Credentials.App.AppID, g.Credentials.App.PrivateKey)
+	if err != nil {
+		return installationToken{}, err
+	}
+	url := fmt.Sprintf("%s/app/installations/%d/access_tokens", apiUrl, g.Credentials.App.InstallationID)
+	resp, err := g.client.R().
+		SetContext(ctx).
+		SetHeader("Accept", githubJsonMediaType).
+		SetHeader("Authorization", fmt.Sprintf("Bearer %s", jwt)).
+		Post(url)
+	if err != nil {
+		return installationToken{}, err
+	}
+	if resp.IsError() {
+		return installationToken{}, githubError(url, resp, resp.Body())
+	}
+	var token installationToken
+	err = json.Unmarshal(resp.Body(), &token)
+	if err != nil {
+		return installationToken{}, fmt.Errorf("error decoding installation token: %w", err)
+	}
+	return token, nil
+}
+
+// githubAppJwt signs the RS256 JWT GitHub expects to authenticate as the app itself
+func githubAppJwt(appID int64, privateKey []byte) (string, error) {
+	key, err := parseRSAPrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-githubAppJwtBackdate).Unix(),
+		"exp": now.Add(githubAppJwtTTL).Unix(),
+		"iss": appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := fmt.Sprintf("%s.%s", base64.RawURLEncoding.EncodeToString(header), base64.RawURLEncoding.EncodeToString(claims))
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%s", unsigned, base64.RawURLEncoding.EncodeToString(signature)), nil
+}
+
+func parseRSAPrivateKey(privateKey []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return nil, errors.New("github app private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing github app private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("github app private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"golang.org/x/sync/errgroup"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// githubTrees serves the git trees API from trees, keyed by "<sha>" and "<sha>?recursive=1"
+func githubTrees(t *testing.T, trees map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path[len("/api/v3/repos/org/repo/git/trees/"):]
+		if r.URL.Query().Get("recursive") != "" {
+			key += "?recursive=1"
+		}
+		tree, ok := trees[key]
+		if !ok {
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, tree)
+	}))
+}
+
+func contentPaths(content []map[string]interface{}) []string {
+	var paths []string
+	for _, entry := range content {
+		paths = append(paths, entry["path"].(string))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestGetContentListsTruncatedTreesBySubtree(t *testing.T) {
+	server := githubTrees(t, map[string]string{
+		"abc?recursive=1": `{"tree":[],"truncated":true}`,
+		"abc":             `{"tree":[{"path":"README.md","type":"blob"},{"path":"base","type":"tree","sha":"r1"},{"path":"deploy","type":"tree","sha":"d1"}],"truncated":false}`,
+		"r1?recursive=1":  `{"tree":[{"path":"service.yaml","type":"blob"}],"truncated":false}`,
+		"d1?recursive=1":  `{"tree":[],"truncated":true}`,
+		"d1":              `{"tree":[{"path":"base","type":"tree","sha":"b1"},{"path":"kustomization.yaml","type":"blob"}],"truncated":false}`,
+		"b1?recursive=1":  `{"tree":[{"path":"deployment.yaml","type":"blob"},{"path":"patches","type":"tree","sha":"p1"},{"path":"patches/replicas.yaml","type":"blob"}],"truncated":false}`,
+	})
+	defer server.Close()
+	github, err := NewGithub(server.URL+"/org/repo//deploy", Credentials{}, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	content, err := github.GetContent(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{
+		"README.md",
+		"base",
+		"base/service.yaml",
+		"deploy",
+		"deploy/base",
+		"deploy/base/deployment.yaml",
+		"deploy/base/patches",
+		"deploy/base/patches/replicas.yaml",
+		"deploy/kustomization.yaml",
+	}
+	if paths := contentPaths(content); !reflect.DeepEqual(paths, want) {
+		t.Errorf("expected paths %v, got %v", want, paths)
+	}
+}
+
+func TestGetContentFailsOnTruncatedLevel(t *testing.T) {
+	server := githubTrees(t, map[string]string{
+		"abc?recursive=1": `{"tree":[],"truncated":true}`,
+		"abc":             `{"tree":[],"truncated":true}`,
+	})
+	defer server.Close()
+	github, err := NewGithub(server.URL+"/org/repo", Credentials{}, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err = github.GetContent(context.Background(), "abc")
+	if err == nil {
+		t.Error("expected a tree truncated without recursion to fail")
+	}
+}
+
+func TestDownloadContentsWritesWholeTree(t *testing.T) {
+	var mutex sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requested = append(requested, r.URL.Path)
+		mutex.Unlock()
+		fmt.Fprint(w, "content")
+	}))
+	defer server.Close()
+	github, err := NewGithub(server.URL+"/org/repo//deploy/app", Credentials{}, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	content := []map[string]interface{}{
+		{"path": "README.md", "type": "blob", "url": server.URL + "/readme"},
+		{"path": "deploy", "type": "tree"},
+		{"path": "deploy/application.yaml", "type": "blob", "url": server.URL + "/application"},
+		{"path": "deploy/app", "type": "tree"},
+		{"path": "deploy/app/kustomization.yaml", "type": "blob", "url": server.URL + "/kustomization"},
+	}
+	dir := t.TempDir()
+
+	summary, err := github.DownloadContents(context.Background(), content, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	sort.Strings(requested)
+	if summary.Files != 3 || !reflect.DeepEqual(requested, []string{"/application", "/kustomization", "/readme"}) {
+		t.Errorf("expected the whole tree to be downloaded, got %d files from %v", summary.Files, requested)
+	}
+	for _, path := range []string{"README.md", "deploy/application.yaml", "deploy/app/kustomization.yaml"} {
+		written, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil || string(written) != "content" {
+			t.Errorf("expected %s to be written at its repository path, got %q: %v", path, written, err)
+		}
+	}
+}
+
+func TestInstallationTokenMintsOncePerInstallation(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	var mints int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&mints, 1)
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprintf(w, `{"token":"token","expires_at":%q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer server.Close()
+	github, err := NewGithub(server.URL+"/org/repo", Credentials{App: &AppCredentials{AppID: 1, InstallationID: 2, PrivateKey: privateKey}}, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	group := errgroup.Group{}
+	for i := 0; i < 10; i++ {
+		group.Go(func() error {
+			token, err := github.installationToken(context.Background())
+			if err == nil && token != "token" {
+				err = fmt.Errorf("unexpected token %s", token)
+			}
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if mints != 1 {
+		t.Errorf("expected a single token to be minted, got %d", mints)
+	}
+}
+
+func TestNewGithubTrustsCACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "abc")
+	}))
+	defer server.Close()
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	github, err := NewGithub(server.URL+"/org/repo", Credentials{CACert: caCert}, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	revision, err := github.ResolveRevision(context.Background(), "main")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if revision != "abc" {
+		t.Errorf("expected revision abc, got %s", revision)
+	}
+	transport, ok := github.client.GetClient().Transport.(*http.Transport)
+	if !ok || transport.Proxy == nil || transport.IdleConnTimeout == 0 {
+		t.Errorf("expected a transport cloned from the default one, got %#v", github.client.GetClient().Transport)
+	}
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/thalleslmF/go-operator/internal/componentspec"
+)
+
+// githubLocation is where a component source lives on github.com or a GitHub Enterprise Server
+type githubLocation struct {
+	componentspec.Location
+}
+
+func (l githubLocation) repoApiUrl() string {
+	return fmt.Sprintf("%s/repos/%s/%s", l.ApiUrl, l.Owner, l.Name)
+}
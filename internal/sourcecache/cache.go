@@ -0,0 +1,264 @@
+package sourcecache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/prometheus/common/log"
+	"golang.org/x/sync/singleflight"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tmpPrefix = ".tmp-"
+
+// Cache stores downloaded component sources on disk, content addressed by
+// provider, repository and commit, evicting the least recently used
+// entries once MaxSize bytes is exceeded. Sources larger than MaxSize are
+// served from a temporary directory without being cached.
+type Cache struct {
+	Dir     string
+	MaxSize int64
+
+	mutex   sync.Mutex
+	entries map[string]*entry
+	size    int64
+	fetches singleflight.Group
+	// oversized are the keys of the sources found larger than MaxSize
+	oversized map[string]bool
+}
+
+type entry struct {
+	size     int64
+	lastUsed time.Time
+	// users counts the renders currently reading the entry, which is never evicted while in use
+	users int
+}
+
+// Key identifies the whole tree of a source at an immutable commit, shared by every
+// component path of the repository
+func Key(provider string, repository string, revision string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{provider, repository, revision}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// New creates the cache directory and loads the entries left by a previous run
+func New(dir string, maxSize int64) (*Cache, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cache{Dir: dir, MaxSize: maxSize, entries: make(map[string]*entry), oversized: make(map[string]bool)}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+		if strings.HasPrefix(file.Name(), tmpPrefix) || !file.IsDir() {
+			os.RemoveAll(path)
+			continue
+		}
+		size, err := dirSize(path)
+		if err != nil {
+			return nil, err
+		}
+		c.entries[file.Name()] = &entry{size: size, lastUsed: file.ModTime()}
+		c.size += size
+	}
+	cacheSize.Set(float64(c.size))
+	return c, nil
+}
+
+// Get returns the directory holding the source for key, calling fetch to populate
+// it on a miss. Concurrent misses on the same key share a single fetch. The returned
+// release func must be called once the caller is done reading the directory.
+func (c *Cache) Get(key string, fetch func(dir string) error) (string, func(), error) {
+	if path, ok := c.acquire(key); ok {
+		cacheHits.Inc()
+		return path, c.releaseFunc(key), nil
+	}
+	if c.isOversized(key) {
+		cacheMisses.Inc()
+		return c.fetchUncached(fetch)
+	}
+	// uncached is only set when this call ran the fetch of an oversized source, which it then owns
+	var uncached string
+	_, err, _ := c.fetches.Do(key, func() (interface{}, error) {
+		if _, ok := c.peek(key); ok {
+			return nil, nil
+		}
+		cacheMisses.Inc()
+		var err error
+		uncached, err = c.populate(key, fetch)
+		return nil, err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if uncached != "" {
+		return uncached, removeFunc(uncached), nil
+	}
+	path, ok := c.acquire(key)
+	if !ok {
+		// oversized, or evicted once the other users of the fetch released it
+		return c.fetchUncached(fetch)
+	}
+	return path, c.releaseFunc(key), nil
+}
+
+// populate fetches the source into the cache, returning the temporary directory holding it
+// instead when it is larger than MaxSize
+func (c *Cache) populate(key string, fetch func(dir string) error) (string, error) {
+	tmpDir, err := ioutil.TempDir(c.Dir, tmpPrefix)
+	if err != nil {
+		return "", err
+	}
+	uncached := false
+	defer func() {
+		if !uncached {
+			os.RemoveAll(tmpDir)
+		}
+	}()
+	err = fetch(tmpDir)
+	if err != nil {
+		return "", err
+	}
+	size, err := dirSize(tmpDir)
+	if err != nil {
+		return "", err
+	}
+	if c.MaxSize > 0 && size > c.MaxSize {
+		log.Info(fmt.Sprintf("Source %s of %d bytes exceeds the cache size, serving it uncached", key, size))
+		c.mutex.Lock()
+		c.oversized[key] = true
+		c.mutex.Unlock()
+		uncached = true
+		return tmpDir, nil
+	}
+	err = os.Rename(tmpDir, filepath.Join(c.Dir, key))
+	if err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[key] = &entry{size: size, lastUsed: time.Now()}
+	c.size += size
+	c.evict(key)
+	return "", nil
+}
+
+// fetchUncached fetches a source into a temporary directory removed on release
+func (c *Cache) fetchUncached(fetch func(dir string) error) (string, func(), error) {
+	tmpDir, err := ioutil.TempDir(c.Dir, tmpPrefix)
+	if err != nil {
+		return "", nil, err
+	}
+	err = fetch(tmpDir)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return "", nil, err
+	}
+	return tmpDir, removeFunc(tmpDir), nil
+}
+
+func removeFunc(dir string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			os.RemoveAll(dir)
+		})
+	}
+}
+
+func (c *Cache) isOversized(key string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.oversized[key]
+}
+
+func (c *Cache) peek(key string) (*entry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[key]
+	return e, ok
+}
+
+func (c *Cache) acquire(key string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	e.users++
+	e.lastUsed = time.Now()
+	return filepath.Join(c.Dir, key), true
+}
+
+func (c *Cache) releaseFunc(key string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+			if e, ok := c.entries[key]; ok {
+				e.users--
+			}
+			c.evict("")
+		})
+	}
+}
+
+// evict removes least recently used entries not in use, other than keep, until the cache fits MaxSize.
+// c.mutex must be held.
+func (c *Cache) evict(keep string) {
+	defer func() { cacheSize.Set(float64(c.size)) }()
+	if c.MaxSize <= 0 || c.size <= c.MaxSize {
+		return
+	}
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].lastUsed.Before(c.entries[keys[j]].lastUsed)
+	})
+	for _, key := range keys {
+		if c.size <= c.MaxSize {
+			return
+		}
+		e := c.entries[key]
+		if e.users > 0 || key == keep {
+			continue
+		}
+		err := os.RemoveAll(filepath.Join(c.Dir, key))
+		if err != nil {
+			log.Error("Error evicting cached source ", key, err)
+			continue
+		}
+		delete(c.entries, key)
+		c.size -= e.size
+		cacheEvictions.Inc()
+	}
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,137 @@
+package sourcecache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fetchBytes returns a fetch writing a file of size bytes, counting its calls in fetches
+func fetchBytes(size int, fetches *int32) func(dir string) error {
+	return func(dir string) error {
+		atomic.AddInt32(fetches, 1)
+		time.Sleep(10 * time.Millisecond)
+		return ioutil.WriteFile(filepath.Join(dir, "source"), []byte(strings.Repeat("x", size)), 0644)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestGetEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, err := New(t.TempDir(), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var fetches int32
+	get := func(key string) string {
+		path, release, err := cache.Get(key, fetchBytes(4, &fetches))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		release()
+		return path
+	}
+	first := get("first")
+	second := get("second")
+	get("first")
+	third := get("third")
+
+	if !exists(first) || exists(second) || !exists(third) {
+		t.Errorf("expected the least recently used second source to be evicted, got first %t, second %t and third %t", exists(first), exists(second), exists(third))
+	}
+	if cache.size != 8 {
+		t.Errorf("expected the cache to hold 8 bytes, got %d", cache.size)
+	}
+}
+
+func TestGetKeepsSourcesInUse(t *testing.T) {
+	cache, err := New(t.TempDir(), 6)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var fetches int32
+	first, release, err := cache.Get("first", fetchBytes(4, &fetches))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer release()
+	second, releaseSecond, err := cache.Get("second", fetchBytes(4, &fetches))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !exists(second) {
+		t.Errorf("expected the source fetched over the size to be kept until released")
+	}
+	releaseSecond()
+
+	if !exists(first) || exists(second) {
+		t.Errorf("expected the source in use to be kept and the released one evicted, got first %t and second %t", exists(first), exists(second))
+	}
+}
+
+func TestGetSharesConcurrentFetches(t *testing.T) {
+	cache, err := New(t.TempDir(), 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var fetches int32
+	paths := make([]string, 10)
+	var wg sync.WaitGroup
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path, release, err := cache.Get("source", fetchBytes(4, &fetches))
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			defer release()
+			paths[i] = path
+		}(i)
+	}
+	wg.Wait()
+
+	if fetches != 1 {
+		t.Errorf("expected a single fetch, got %d", fetches)
+	}
+	for _, path := range paths {
+		if path != paths[0] {
+			t.Errorf("expected every Get to share %s, got %s", paths[0], path)
+		}
+	}
+}
+
+func TestGetServesOversizedSourcesUncached(t *testing.T) {
+	cache, err := New(t.TempDir(), 6)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var fetches int32
+	for i := 0; i < 2; i++ {
+		path, release, err := cache.Get("source", fetchBytes(8, &fetches))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		content, err := ioutil.ReadFile(filepath.Join(path, "source"))
+		if err != nil || len(content) != 8 {
+			t.Errorf("expected the source to be served, got %d bytes: %v", len(content), err)
+		}
+		release()
+		if exists(path) {
+			t.Errorf("expected the uncached source to be removed once released")
+		}
+	}
+
+	if fetches != 2 || len(cache.entries) != 0 || cache.size != 0 {
+		t.Errorf("expected the source to be fetched on every Get without being cached, got %d fetches and %d entries", fetches, len(cache.entries))
+	}
+}
@@ -0,0 +1,29 @@
+package sourcecache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	cacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "charles_source_cache_hits_total",
+		Help: "Number of component sources served from the local cache",
+	})
+	cacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "charles_source_cache_misses_total",
+		Help: "Number of component sources downloaded because they were not cached",
+	})
+	cacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "charles_source_cache_evictions_total",
+		Help: "Number of cached component sources evicted to stay under the size limit",
+	})
+	cacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "charles_source_cache_size_bytes",
+		Help: "Total size of the cached component sources",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(cacheHits, cacheMisses, cacheEvictions, cacheSize)
+}
@@ -0,0 +1,76 @@
+package substitute
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholderPattern matches $${ escapes and ${NAME} or ${NAME:=default} placeholders
+var placeholderPattern = regexp.MustCompile(`\$\$\{|\$\{([_a-zA-Z][_a-zA-Z0-9]*)(:=([^}]*))?\}`)
+
+// UndefinedError lists the placeholders without variable nor default found in strict mode
+type UndefinedError struct {
+	Names []string
+}
+
+func (e UndefinedError) Error() string {
+	return fmt.Sprintf("undefined substitution variables: %s", strings.Join(e.Names, ", "))
+}
+
+// Object replaces the placeholders of the string values of a decoded object with variables, values
+// staying strings whatever the variables hold. Placeholders without variable are replaced by their
+// default, or kept as is unless strict is set. Any $ not starting a placeholder is kept and $${ is
+// unescaped to a literal ${.
+func Object(object map[string]interface{}, variables map[string]string, strict bool) error {
+	undefined := make(map[string]bool)
+	substituteValue(object, variables, undefined)
+	if strict && len(undefined) > 0 {
+		names := make([]string, 0, len(undefined))
+		for name := range undefined {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return UndefinedError{Names: names}
+	}
+	return nil
+}
+
+// substituteValue substitutes the strings of a decoded value, recording the undefined placeholders
+func substituteValue(value interface{}, variables map[string]string, undefined map[string]bool) interface{} {
+	switch typed := value.(type) {
+	case string:
+		return substituteString(typed, variables, undefined)
+	case map[string]interface{}:
+		for key, field := range typed {
+			typed[key] = substituteValue(field, variables, undefined)
+		}
+		return typed
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = substituteValue(item, variables, undefined)
+		}
+		return typed
+	default:
+		return value
+	}
+}
+
+func substituteString(value string, variables map[string]string, undefined map[string]bool) string {
+	return placeholderPattern.ReplaceAllStringFunc(value, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		groups := placeholderPattern.FindStringSubmatch(match)
+		name := groups[1]
+		if variable, ok := variables[name]; ok {
+			return variable
+		}
+		if groups[2] != "" {
+			return groups[3]
+		}
+		undefined[name] = true
+		return match
+	})
+}
@@ -0,0 +1,82 @@
+package substitute
+
+import (
+	"reflect"
+	"sigs.k8s.io/yaml"
+	"testing"
+)
+
+func TestObject(t *testing.T) {
+	variables := map[string]string{
+		"HOST":  "db.example.com",
+		"QUOTE": `say "hello": world`,
+		"LINES": "first\nsecond",
+	}
+	tests := []struct {
+		name     string
+		manifest string
+		expected map[string]interface{}
+		strict   bool
+		err      bool
+	}{
+		{
+			name:     "multiline value",
+			manifest: "data:\n  config: |\n    host: ${HOST}\n    port: 5432\n",
+			expected: map[string]interface{}{"data": map[string]interface{}{"config": "host: db.example.com\nport: 5432\n"}},
+		},
+		{
+			name:     "quoted value",
+			manifest: "data:\n  message: \"${QUOTE}\"\n",
+			expected: map[string]interface{}{"data": map[string]interface{}{"message": `say "hello": world`}},
+		},
+		{
+			name:     "multiline variable",
+			manifest: "data:\n  message: '${LINES}'\n",
+			expected: map[string]interface{}{"data": map[string]interface{}{"message": "first\nsecond"}},
+		},
+		{
+			name:     "escaped placeholder",
+			manifest: "data:\n  script: echo $${HOST} costs $5\n",
+			expected: map[string]interface{}{"data": map[string]interface{}{"script": "echo ${HOST} costs $5"}},
+		},
+		{
+			name:     "default in list",
+			manifest: "args:\n- --port=${PORT:=8080}\n- 3\n",
+			expected: map[string]interface{}{"args": []interface{}{"--port=8080", float64(3)}},
+		},
+		{
+			name:     "undefined kept",
+			manifest: "data:\n  host: ${UNKNOWN}\n",
+			expected: map[string]interface{}{"data": map[string]interface{}{"host": "${UNKNOWN}"}},
+		},
+		{
+			name:     "undefined in strict mode",
+			manifest: "data:\n  host: ${UNKNOWN}\n",
+			strict:   true,
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var object map[string]interface{}
+			if err := yaml.Unmarshal([]byte(test.manifest), &object); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			err := Object(object, variables, test.strict)
+
+			if test.err {
+				if _, ok := err.(UndefinedError); !ok {
+					t.Errorf("expected an UndefinedError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(object, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, object)
+			}
+		})
+	}
+}
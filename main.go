@@ -21,15 +21,23 @@ import (
 	"fmt"
 	"github.com/prometheus/common/log"
 	iocharlescdv1 "github.com/thalleslmF/go-operator/api/v1"
+	iocharlescdv1beta1 "github.com/thalleslmF/go-operator/api/v1beta1"
 	"github.com/thalleslmF/go-operator/internal/controllers"
 	"github.com/thalleslmF/go-operator/internal/k8s"
-	"golang.org/x/sync/errgroup"
+	"github.com/thalleslmF/go-operator/internal/options"
+	"github.com/thalleslmF/go-operator/internal/receiver"
+	"github.com/thalleslmF/go-operator/internal/sourcecache"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamiclister"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
 	"os"
+	"path/filepath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -50,16 +58,26 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(iocharlescdv1.AddToScheme(scheme))
+	utilruntime.Must(iocharlescdv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
-	var group errgroup.Group
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var receiverAddr string
+	var receiverSecret string
+	var sourceCacheDir string
+	var sourceCacheMaxSize int64
+	var renderOptions options.Render
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&receiverAddr, "webhook-receiver-bind-address", ":9292", "The address the git webhook receiver binds to.")
+	flag.StringVar(&receiverSecret, "webhook-receiver-secret", "", "The namespace/name of the Secret holding the git webhooks shared secret. The receiver is disabled when empty.")
+	flag.StringVar(&sourceCacheDir, "source-cache-dir", filepath.Join(os.TempDir(), "charles-sources"), "The directory downloaded component sources are cached in.")
+	flag.Int64Var(&sourceCacheMaxSize, "source-cache-max-size", 1<<30, "The size in bytes above which the least recently used cached sources are evicted.")
+	renderOptions.BindFlags(flag.CommandLine)
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -88,32 +106,68 @@ func main() {
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	if err = renderOptions.Complete(); err != nil {
+		setupLog.Error(err, "invalid render options")
+		os.Exit(1)
+	}
+	sourceCache, err := sourcecache.New(sourceCacheDir, sourceCacheMaxSize)
+	if err != nil {
+		setupLog.Error(err, "unable to create source cache", "dir", sourceCacheDir)
+		os.Exit(1)
+	}
 	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
 	charlesController := &controllers.CharlesDeploymentController{
-		Client:         mgr.GetClient(),
-		Scheme:         mgr.GetScheme(),
-		Queue:          workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		DynamicService: k8s.DynamicService{Client: dynClient},
-		CharlesLister:  dynamiclister.New(indexer, schema.GroupVersionResource{Group: "charlescd.io", Version: "v1", Resource: "charlesdeployments"}),
-		Informers:      make(map[string]cache.SharedIndexInformer),
-		DynamicClient:  dynClient,
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		DynamicService:    k8s.DynamicService{Client: dynClient, Mapper: mapper},
+		CharlesLister:     dynamiclister.New(indexer, schema.GroupVersionResource{Group: "charlescd.io", Version: "v1", Resource: "charlesdeployments"}),
+		Informers:         make(map[string]cache.SharedIndexInformer),
+		DynamicClient:     dynClient,
+		SourceCache:       sourceCache,
+		RepositoryOptions: renderOptions.Repository,
+		KustomizeOptions:  renderOptions.Kustomize,
 	}
 
+	if receiverSecret != "" {
+		secretNamespace, secretName, err := cache.SplitMetaNamespaceKey(receiverSecret)
+		if err != nil {
+			setupLog.Error(err, "invalid webhook receiver secret", "secret", receiverSecret)
+			os.Exit(1)
+		}
+		pushEvents := make(chan event.GenericEvent)
+		charlesController.PushEvents = pushEvents
+		err = mgr.Add(receiver.Receiver{
+			Client:  mgr.GetClient(),
+			Events:  pushEvents,
+			Secret:  client.ObjectKey{Namespace: secretNamespace, Name: secretName},
+			Addr:    receiverAddr,
+			Elected: mgr.Elected(),
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to add webhook receiver")
+			os.Exit(1)
+		}
+	}
 	if err = (charlesController).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CharlesDeployment")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&iocharlescdv1.CharlesDeployment{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CharlesDeployment")
+			os.Exit(1)
+		}
+	}
 
 	if err != nil {
 		fmt.Println("error", err)
 	}
-	group.Go(func() error {
-		return mgr.Start(ctrl.SetupSignalHandler())
-	})
-	group.Go(func() error {
-		return charlesController.Start()
-	})
-	err = group.Wait()
+	err = mgr.Start(ctrl.SetupSignalHandler())
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
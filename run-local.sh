@@ -1 +1 @@
-kubectl apply -f charles-deployment-crd.yaml && kubectl create namespace dev && kubectl apply -f charles-deployment.yaml -n dev && go run main.go
\ No newline at end of file
+kubectl apply -f config/crd/bases/charlescd.io_charlesdeployments.yaml && kubectl create namespace dev && kubectl apply -f charles-deployment.yaml -n dev && ENABLE_WEBHOOKS=false go run main.go
\ No newline at end of file